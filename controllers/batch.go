@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"yinyue/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBatches 内存中保留的批量下载数
+const maxBatches = 50
+
+// batchSong 批量下载中的歌曲
+type batchSong struct {
+	Source string
+	ID     string
+	Name   string
+	Artist string
+	TaskID string
+	// Skipped 加入批量时已在音乐库中
+	Skipped bool
+}
+
+// DownloadBatch 批量下载
+type DownloadBatch struct {
+	ID        string
+	Name      string
+	Quality   string
+	CreatedAt string
+	Songs     []batchSong
+}
+
+// BatchProgress 批量下载的汇总进度
+type BatchProgress struct {
+	ID          string         `json:"id"`
+	Name        string         `json:"name"`
+	Quality     string         `json:"quality"`
+	CreatedAt   string         `json:"createdAt"`
+	Status      string         `json:"status"` // running, done
+	Total       int            `json:"total"`
+	Skipped     int            `json:"skipped"` // 加入时已下载
+	Counts      map[string]int `json:"counts"`  // 按任务状态统计 (pending/waiting/downloading/success/failed)
+	Progress    float64        `json:"progress"`
+	FailedSongs []gin.H        `json:"failedSongs"`
+}
+
+var (
+	downloadBatches = make(map[string]*DownloadBatch)
+	batchOrder      []string
+	batchMutex      sync.RWMutex
+)
+
+// startBatch 将歌曲逐首加入下载队列并记录为一个批量
+func startBatch(name, br string, songs []storage.PlaylistSong) *DownloadBatch {
+	batch := &DownloadBatch{
+		ID:        newID(),
+		Name:      name,
+		Quality:   br,
+		CreatedAt: time.Now().Format("2006-01-02 15:04:05"),
+	}
+
+	seen := make(map[storage.SongRef]bool, len(songs))
+	for _, s := range songs {
+		ref := storage.SongRef{ID: s.ID, Source: s.Source}
+		if s.ID == "" || s.Source == "" || seen[ref] {
+			continue
+		}
+		seen[ref] = true
+
+		taskID, status := enqueueDownload(s.Source, s.ID, s.Name, s.Artist, s.Album, s.Duration, br)
+		batch.Songs = append(batch.Songs, batchSong{
+			Source:  s.Source,
+			ID:      s.ID,
+			Name:    s.Name,
+			Artist:  s.Artist,
+			TaskID:  taskID,
+			Skipped: status == enqueueDownloaded,
+		})
+	}
+
+	batchMutex.Lock()
+	downloadBatches[batch.ID] = batch
+	batchOrder = append(batchOrder, batch.ID)
+	if len(batchOrder) > maxBatches {
+		delete(downloadBatches, batchOrder[0])
+		batchOrder = batchOrder[1:]
+	}
+	batchMutex.Unlock()
+
+	return batch
+}
+
+// progress 汇总批量中各任务的状态
+func (b *DownloadBatch) progress() BatchProgress {
+	p := BatchProgress{
+		ID:          b.ID,
+		Name:        b.Name,
+		Quality:     b.Quality,
+		CreatedAt:   b.CreatedAt,
+		Total:       len(b.Songs),
+		Counts:      map[string]int{"pending": 0, "waiting": 0, "downloading": 0, "success": 0, "failed": 0},
+		FailedSongs: []gin.H{},
+	}
+
+	var sum float64
+	taskMutex.RLock()
+	for _, s := range b.Songs {
+		if s.Skipped {
+			p.Skipped++
+			sum += 100
+			continue
+		}
+		task, ok := downloadTasks[s.TaskID]
+		if !ok {
+			continue
+		}
+		p.Counts[task.Status]++
+		switch task.Status {
+		case "success":
+			sum += 100
+		case "downloading":
+			sum += float64(task.Progress)
+		case "failed":
+			sum += 100
+			p.FailedSongs = append(p.FailedSongs, gin.H{
+				"source": s.Source, "id": s.ID, "name": s.Name, "artist": s.Artist,
+				"error": task.Error, "errorType": task.ErrorType,
+			})
+		}
+	}
+	taskMutex.RUnlock()
+
+	if p.Total > 0 {
+		p.Progress = sum / float64(p.Total)
+	}
+	p.Status = "done"
+	if p.Counts["pending"]+p.Counts["waiting"]+p.Counts["downloading"] > 0 {
+		p.Status = "running"
+	}
+	return p
+}
+
+// batchSongs 根据请求解析要下载的歌曲：歌单、排行榜或歌曲列表
+func batchSongs(playlist, toplist *storage.SongRef, top int, songs []storage.PlaylistSong) (string, []storage.PlaylistSong, error) {
+	switch {
+	case playlist != nil:
+		p, ok := storage.GetPlaylist(playlist.ID, playlist.Source)
+		if !ok {
+			return "", nil, storage.ErrPlaylistNotFound
+		}
+		return p.Name, p.Songs, nil
+
+	case toplist != nil:
+		chart, err := fetchToplist(toplist.Source, toplist.ID)
+		if err != nil {
+			return "", nil, err
+		}
+		if top > 0 && len(chart) > top {
+			chart = chart[:top]
+		}
+		result := make([]storage.PlaylistSong, len(chart))
+		for i, s := range chart {
+			result[i] = storage.PlaylistSong{ID: s.ID, Source: s.Source, Name: s.Name, Artist: s.Artist, Album: s.Album, Duration: s.Duration}
+		}
+		name := fetchToplistName(toplist.Source, toplist.ID)
+		if name == "" {
+			name = "排行榜 " + toplist.ID
+		}
+		return name, result, nil
+
+	case len(songs) > 0:
+		return "选择的歌曲", songs, nil
+	}
+	return "", nil, errors.New("参数错误")
+}
+
+// StartBatchDownload 批量下载歌单、排行榜或歌曲列表中未下载的歌曲
+func StartBatchDownload(c *gin.Context) {
+	var req struct {
+		Playlist *storage.SongRef       `json:"playlist"`
+		Toplist  *storage.SongRef       `json:"toplist"`
+		Top      int                    `json:"top"`
+		Songs    []storage.PlaylistSong `json:"songs"`
+		Quality  string                 `json:"quality"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 400, "message": "参数错误"})
+		return
+	}
+	if _, ok := qualityRank[req.Quality]; req.Quality != "" && !ok {
+		c.JSON(400, gin.H{"code": 400, "message": "音质参数错误"})
+		return
+	}
+
+	name, songs, err := batchSongs(req.Playlist, req.Toplist, req.Top, req.Songs)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrPlaylistNotFound):
+			c.JSON(404, gin.H{"code": 404, "message": "歌单不存在"})
+		case req.Toplist != nil:
+			c.JSON(500, gin.H{"code": 500, "message": "获取排行榜失败"})
+		default:
+			c.JSON(400, gin.H{"code": 400, "message": err.Error()})
+		}
+		return
+	}
+
+	batch := startBatch(name, preferredQuality(req.Quality), songs)
+	c.JSON(200, gin.H{"code": 200, "message": "已加入下载队列", "data": batch.progress()})
+}
+
+// GetBatchDownload 获取批量下载进度
+func GetBatchDownload(c *gin.Context) {
+	batchMutex.RLock()
+	batch, ok := downloadBatches[c.Param("id")]
+	batchMutex.RUnlock()
+	if !ok {
+		c.JSON(404, gin.H{"code": 404, "message": "批量下载不存在"})
+		return
+	}
+	c.JSON(200, gin.H{"code": 200, "data": batch.progress()})
+}
+
+// GetBatchDownloads 获取最近的批量下载
+func GetBatchDownloads(c *gin.Context) {
+	batchMutex.RLock()
+	batches := make([]*DownloadBatch, 0, len(batchOrder))
+	for i := len(batchOrder) - 1; i >= 0; i-- {
+		batches = append(batches, downloadBatches[batchOrder[i]])
+	}
+	batchMutex.RUnlock()
+
+	result := make([]BatchProgress, len(batches))
+	for i, b := range batches {
+		result[i] = b.progress()
+	}
+	c.JSON(200, gin.H{"code": 200, "data": result})
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// breakerThreshold 音源连续失败（重试后仍失败）达到该次数后熔断
+const breakerThreshold = 3
+
+// breakerCooldown 熔断持续时间，之后放行一次试探请求
+const breakerCooldown = time.Minute
+
+// errSourceUnavailable 音源已熔断，不再请求上游
+var errSourceUnavailable = errors.New("音源暂时不可用")
+
+// 熔断器状态
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open" // 冷却结束，正在试探
+)
+
+// SourceBreaker 音源熔断状态
+type SourceBreaker struct {
+	Source    string `json:"source"`
+	State     string `json:"state"`
+	Failures  int    `json:"failures"` // 连续失败次数
+	LastError string `json:"lastError,omitempty"`
+	OpenUntil string `json:"openUntil,omitempty"` // 熔断结束时间，试探中为试探超时时间
+}
+
+type breaker struct {
+	state     string
+	failures  int
+	lastError string
+	openUntil time.Time // open 时为冷却结束时间，half-open 时为试探请求的超时时间
+}
+
+var (
+	breakers     = make(map[string]*breaker)
+	breakerMutex sync.Mutex
+)
+
+// allowSource 判断是否可以请求该音源，熔断中返回 errSourceUnavailable
+// 冷却结束后只放行一个试探请求，其结果决定恢复还是继续熔断；
+// 试探请求在一个冷却周期内没有记录结果时再放行一个，避免一直停在试探状态
+func allowSource(source string) error {
+	breakerMutex.Lock()
+	defer breakerMutex.Unlock()
+
+	b := breakers[source]
+	if b == nil || b.state == breakerClosed {
+		return nil
+	}
+	now := time.Now()
+	if now.Before(b.openUntil) {
+		return errSourceUnavailable
+	}
+	b.state = breakerHalfOpen
+	b.openUntil = now.Add(breakerCooldown)
+	return nil
+}
+
+// recordSourceSuccess 记录音源请求成功，关闭熔断
+func recordSourceSuccess(source string) {
+	breakerMutex.Lock()
+	b := breakers[source]
+	recovered := b != nil && b.state != breakerClosed
+	delete(breakers, source)
+	breakerMutex.Unlock()
+
+	if recovered {
+		log.Printf("音源 %s 已恢复", source)
+	}
+}
+
+// recordSourceFailure 记录音源请求失败，连续失败过多或试探失败时熔断
+func recordSourceFailure(source, reason string) {
+	breakerMutex.Lock()
+	b := breakers[source]
+	if b == nil {
+		b = &breaker{state: breakerClosed}
+		breakers[source] = b
+	}
+	b.failures++
+	b.lastError = reason
+	open := b.state == breakerHalfOpen || (b.state == breakerClosed && b.failures >= breakerThreshold)
+	if open {
+		b.state = breakerOpen
+		b.openUntil = time.Now().Add(breakerCooldown)
+	}
+	failures := b.failures
+	breakerMutex.Unlock()
+
+	if open {
+		log.Printf("音源 %s 连续 %d 次请求失败，暂停请求 %v: %s", source, failures, breakerCooldown, reason)
+	}
+}
+
+// allSourcesOpen 所有音源是否都已熔断
+func allSourcesOpen() bool {
+	breakerMutex.Lock()
+	defer breakerMutex.Unlock()
+
+	for _, source := range matchSources {
+		if b := breakers[source]; b == nil || b.state == breakerClosed {
+			return false
+		}
+	}
+	return true
+}
+
+// sourceBreakers 有失败记录的音源的熔断状态
+func sourceBreakers() []SourceBreaker {
+	breakerMutex.Lock()
+	defer breakerMutex.Unlock()
+
+	list := make([]SourceBreaker, 0, len(breakers))
+	for source, b := range breakers {
+		s := SourceBreaker{
+			Source:    source,
+			State:     b.state,
+			Failures:  b.failures,
+			LastError: b.lastError,
+		}
+		if b.state != breakerClosed {
+			s.OpenUntil = b.openUntil.Format("2006-01-02 15:04:05")
+		}
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Source < list[j].Source })
+	return list
+}
@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// resetUpstreamState 清空熔断器和上游健康状态
+func resetUpstreamState(t *testing.T) {
+	reset := func() {
+		breakerMutex.Lock()
+		breakers = make(map[string]*breaker)
+		breakerMutex.Unlock()
+
+		healthMutex.Lock()
+		upstreamHealth = UpstreamHealth{Healthy: true}
+		healthMutex.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+// expireBreaker 让熔断（或试探）立即到期
+func expireBreaker(source string) {
+	breakerMutex.Lock()
+	breakers[source].openUntil = time.Now()
+	breakerMutex.Unlock()
+}
+
+func breakerState(source string) string {
+	breakerMutex.Lock()
+	defer breakerMutex.Unlock()
+	if b := breakers[source]; b != nil {
+		return b.state
+	}
+	return breakerClosed
+}
+
+func TestBreaker(t *testing.T) {
+	resetUpstreamState(t)
+
+	for i := 0; i < breakerThreshold-1; i++ {
+		recordSourceFailure("qq", "503")
+	}
+	if err := allowSource("qq"); err != nil || breakerState("qq") != breakerClosed {
+		t.Fatalf("未达到阈值时不应熔断: %v, %s", err, breakerState("qq"))
+	}
+
+	recordSourceFailure("qq", "503")
+	if err := allowSource("qq"); !errors.Is(err, errSourceUnavailable) {
+		t.Fatalf("达到阈值后应熔断, got %v", err)
+	}
+	if err := allowSource("kuwo"); err != nil {
+		t.Fatalf("其他音源不受影响, got %v", err)
+	}
+
+	// 冷却结束只放行一个试探请求
+	expireBreaker("qq")
+	if err := allowSource("qq"); err != nil || breakerState("qq") != breakerHalfOpen {
+		t.Fatalf("冷却结束应放行试探请求: %v, %s", err, breakerState("qq"))
+	}
+	if err := allowSource("qq"); !errors.Is(err, errSourceUnavailable) {
+		t.Fatalf("试探中不应放行其他请求, got %v", err)
+	}
+
+	// 试探失败重新熔断
+	recordSourceFailure("qq", "503")
+	if breakerState("qq") != breakerOpen {
+		t.Fatalf("试探失败应重新熔断, got %s", breakerState("qq"))
+	}
+
+	// 试探没有记录结果时，超时后再放行一个
+	expireBreaker("qq")
+	allowSource("qq")
+	expireBreaker("qq")
+	if err := allowSource("qq"); err != nil {
+		t.Fatalf("试探超时后应再放行一个请求, got %v", err)
+	}
+
+	// 试探成功恢复
+	recordSourceSuccess("qq")
+	if err := allowSource("qq"); err != nil || breakerState("qq") != breakerClosed {
+		t.Fatalf("试探成功应恢复: %v, %s", err, breakerState("qq"))
+	}
+}
+
+func TestRecordUpstreamResultIsolation(t *testing.T) {
+	resetUpstreamState(t)
+
+	// 单个音源的 5xx 只熔断该音源
+	for i := 0; i < breakerThreshold+2; i++ {
+		recordUpstreamResult("kuwo", 503, nil)
+	}
+	if !upstreamHealthy() {
+		t.Fatal("单个音源失败不应进入离线模式")
+	}
+
+	// 所有音源都熔断时进入离线模式
+	for _, source := range matchSources {
+		for i := 0; i < breakerThreshold; i++ {
+			recordUpstreamResult(source, 503, nil)
+		}
+	}
+	if upstreamHealthy() {
+		t.Fatal("所有音源熔断后应进入离线模式")
+	}
+}
+
+func TestRecordUpstreamResultUnreachable(t *testing.T) {
+	resetUpstreamState(t)
+
+	// 连不上 API 时计入上游健康状态
+	for i := 0; i < unhealthyThreshold; i++ {
+		recordUpstreamResult("qq", 0, errUpstreamRequest)
+	}
+	if upstreamHealthy() {
+		t.Fatal("连续无法连接应进入离线模式")
+	}
+
+	// 超时不计入
+	resetUpstreamState(t)
+	for i := 0; i < unhealthyThreshold; i++ {
+		recordUpstreamResult("qq", 0, errUpstreamTimeout)
+	}
+	if !upstreamHealthy() {
+		t.Fatal("超时只由熔断器处理")
+	}
+}
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"yinyue/models"
+	"yinyue/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 缓存状态，通过 X-Cache 响应头返回
+const (
+	cacheHit    = "HIT"
+	cacheMiss   = "MISS"
+	cacheStale  = "STALE"  // 返回了过期数据（后台刷新中或上游不可用）
+	cacheBypass = "BYPASS" // 跳过缓存直接请求上游
+)
+
+// cacheResult 上游数据的缓存情况
+type cacheResult struct {
+	State string
+	Time  time.Time // 数据从上游获取的时间
+}
+
+// cacheTTL 各类上游请求的缓存有效期
+var cacheTTL = map[string]time.Duration{
+	"search":   10 * time.Minute,
+	"toplists": 6 * time.Hour,
+	"toplist":  30 * time.Minute,
+	"playlist": 10 * time.Minute,
+	"pic":      24 * time.Hour, // Subsonic 封面，见 fetchCoverArt
+}
+
+// staleWhileRevalidate 过期后先返回旧数据、再在后台刷新的请求类型
+var staleWhileRevalidate = map[string]bool{
+	"toplists": true,
+	"toplist":  true,
+}
+
+// cacheRetention 缓存保留时间，超过后由定时任务删除
+const cacheRetention = 7 * 24 * time.Hour
+
+var (
+	revalidating    = make(map[string]bool)
+	revalidateMutex sync.Mutex
+)
+
+// fetchUpstream 获取并解析上游数据（见 decodeUpstream），有效期内直接使用缓存，返回缓存情况
+// fresh 为 true 时跳过缓存，结果仍会写入缓存
+// 上游不可用（离线模式或本次请求失败）时返回过期的缓存，没有缓存时返回错误
+func fetchUpstream(client *http.Client, params url.Values, fresh bool, v interface{}) (cacheResult, error) {
+	kind, source := params.Get("type"), params.Get("source")
+	entry, cached := storage.GetCache(params.Encode())
+	healthy := upstreamHealthy()
+
+	if cached && !fresh {
+		expired := time.Since(entry.Time) >= cacheTTL[kind]
+		if !expired || staleWhileRevalidate[kind] || !healthy {
+			if err := decodeUpstream(kind, source, entry.Status, entry.Body, v); err == nil {
+				if !expired {
+					return cacheResult{State: cacheHit, Time: entry.Time}, nil
+				}
+				if healthy {
+					go revalidate(client, params)
+				}
+				return cacheResult{State: cacheStale, Time: entry.Time}, nil
+			}
+		}
+	}
+
+	state := cacheMiss
+	if fresh {
+		state = cacheBypass
+	}
+	if !healthy {
+		return cacheResult{State: state}, errUpstreamOffline
+	}
+
+	err := requestUpstream(client, params, v)
+	if err != nil && cached && !fresh && upstreamUnavailable(err) {
+		if decodeUpstream(kind, source, entry.Status, entry.Body, v) == nil {
+			return cacheResult{State: cacheStale, Time: entry.Time}, nil
+		}
+	}
+	return cacheResult{State: state, Time: time.Now()}, err
+}
+
+// setCacheHeader 设置 X-Cache 响应头
+func setCacheHeader(c *gin.Context, r cacheResult) {
+	if r.State != "" {
+		c.Header("X-Cache", r.State)
+	}
+}
+
+// upstreamSuccess 上游数据的成功响应，使用过期缓存时标记 stale
+func upstreamSuccess(data interface{}, r cacheResult) models.Response {
+	resp := models.Success(data)
+	if r.State == cacheStale {
+		resp.Stale = true
+		resp.CachedAt = r.Time.Format("2006-01-02 15:04:05")
+	}
+	return resp
+}
+
+// requestUpstream 请求上游并解析，成功时写入缓存
+func requestUpstream(client *http.Client, params url.Values, v interface{}) error {
+	kind, source := params.Get("type"), params.Get("source")
+	status, body, err := getUpstream(client, params)
+	if err != nil {
+		return err
+	}
+	if err := decodeUpstream(kind, source, status, body, v); err != nil {
+		return err
+	}
+
+	err = storage.SetCache(storage.CacheEntry{
+		Key:    params.Encode(),
+		Type:   kind,
+		Source: source,
+		Status: status,
+		Body:   body,
+		Time:   time.Now(),
+	})
+	if err != nil {
+		log.Printf("写入上游缓存失败 [%s/%s]: %v", kind, source, err)
+	}
+	return nil
+}
+
+// revalidate 后台刷新过期的缓存，同一请求同时只刷新一次
+func revalidate(client *http.Client, params url.Values) {
+	key := params.Encode()
+	revalidateMutex.Lock()
+	if revalidating[key] {
+		revalidateMutex.Unlock()
+		return
+	}
+	revalidating[key] = true
+	revalidateMutex.Unlock()
+
+	defer func() {
+		revalidateMutex.Lock()
+		delete(revalidating, key)
+		revalidateMutex.Unlock()
+	}()
+
+	var data json.RawMessage
+	if err := requestUpstream(client, params, &data); err != nil {
+		log.Printf("刷新上游缓存失败 [%s/%s]: %v", params.Get("type"), params.Get("source"), err)
+	}
+}
+
+// pruneCache 删除超过保留时间的缓存
+func pruneCache(now time.Time) {
+	if n, err := storage.PruneCache(now.Add(-cacheRetention)); err != nil {
+		log.Printf("清理上游缓存失败: %v", err)
+	} else if n > 0 {
+		log.Printf("清理过期上游缓存 %d 条", n)
+	}
+}
+
+// GetCacheStats 获取上游缓存统计
+func GetCacheStats(c *gin.Context) {
+	c.JSON(200, models.Success(storage.GetCacheStats()))
+}
+
+// PurgeCache 清除上游缓存，可按 type (search/toplists/toplist/playlist/pic) 和 source 过滤
+func PurgeCache(c *gin.Context) {
+	cacheType := c.Query("type")
+	if _, ok := cacheTTL[cacheType]; cacheType != "" && !ok {
+		c.JSON(400, models.Error(400, "类型参数错误"))
+		return
+	}
+
+	n, err := storage.PurgeCache(cacheType, c.Query("source"))
+	if err != nil {
+		c.JSON(500, models.Error(500, "清除缓存失败"))
+		return
+	}
+	c.JSON(200, models.Response{Code: 200, Message: "已清除缓存", Data: gin.H{"purged": n}})
+}
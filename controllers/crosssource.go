@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"log"
+	"sync/atomic"
+)
+
+// crossSourceEnabled 原音源下载失败时是否从其他音源匹配同一首歌
+var crossSourceEnabled atomic.Bool
+
+// durationTolerance 时长都已知时，相差超过该秒数的候选歌曲不视为同一首
+const durationTolerance = 5
+
+// findSubstitute 在其他音源中搜索同一艺术家和歌名的歌曲，返回置信度最高的一首
+// 原音源的搜索结果中能找到原歌曲时，用它的时长排除时长不符的候选
+func findSubstitute(source, id, name, artist, album string) (matchCandidate, bool) {
+	if name == "" || artist == "" {
+		return matchCandidate{}, false
+	}
+
+	candidates, err := findMatches(matchQuery{Title: name, Artist: artist, Album: album}, matchSources)
+	if err != nil {
+		return matchCandidate{}, false
+	}
+
+	duration := 0
+	for _, c := range candidates {
+		if c.Source == source && c.ID == id {
+			duration = c.Duration
+			break
+		}
+	}
+
+	// 候选已按分数从高到低排序
+	for _, c := range candidates {
+		if c.Score < matchThreshold {
+			break
+		}
+		if c.Source == source {
+			continue
+		}
+		if duration > 0 && c.Duration > 0 && absInt(c.Duration-duration) > durationTolerance {
+			continue
+		}
+		return c, true
+	}
+	return matchCandidate{}, false
+}
+
+// fetchWithFallback 下载歌曲，原音源返回错误且开启跨音源匹配时改从匹配到的音源下载
+// 成功使用替换歌曲时返回该候选
+func fetchWithFallback(task *DownloadTask, source, id, name, artist, album, br, filePath string) (*matchCandidate, *downloadError) {
+	err := fetchToFile(task, source, id, br, filePath)
+	if err == nil || err.Type != errTypeUpstream || !crossSourceEnabled.Load() {
+		return nil, err
+	}
+
+	alt, ok := findSubstitute(source, id, name, artist, album)
+	if !ok {
+		return nil, err
+	}
+	log.Printf("%s_%s 下载失败，改用 %s_%s (匹配度 %.2f)", source, id, alt.Source, alt.ID, alt.Score)
+
+	taskMutex.Lock()
+	task.MatchSource = alt.Source
+	task.MatchID = alt.ID
+	task.Progress = 0
+	taskMutex.Unlock()
+
+	if err := fetchToFile(task, alt.Source, alt.ID, br, filePath); err != nil {
+		return nil, err
+	}
+	return &alt, nil
+}
+
+// absInt 整数绝对值
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// fileRef 音乐库中歌曲文件实际来自的音源和歌曲ID，升级音质等需要重新获取文件时使用
+func (s DownloadedSong) fileRef() (source, id string) {
+	if s.MatchSource != "" {
+		return s.MatchSource, s.MatchID
+	}
+	return s.Source, s.ID
+}
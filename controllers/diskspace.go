@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// 磁盘空间保护设置（字节），0 表示不限制；设置接口与下载任务并发读写
+var (
+	minFreeSpace   atomic.Int64
+	maxLibrarySize atomic.Int64
+)
+
+// guardCheckInterval 下载过程中每写入这么多字节重新检查一次空间
+const guardCheckInterval = 4 << 20
+
+const mb = 1 << 20
+
+// setDiskGuard 根据设置（MB）更新磁盘空间保护
+func setDiskGuard(minFreeMB, maxLibraryMB int64) {
+	minFreeSpace.Store(minFreeMB * mb)
+	maxLibrarySize.Store(maxLibraryMB * mb)
+}
+
+// librarySize 计算音乐库已占用空间
+func librarySize() int64 {
+	libMutex.RLock()
+	defer libMutex.RUnlock()
+
+	var total int64
+	for _, song := range downloadedSongs {
+		total += song.Size
+	}
+	return total
+}
+
+// checkDiskSpace 检查目录所在磁盘与音乐库容量是否还能容纳 need 字节，
+// written 为当前任务已写入的字节数（尚未计入音乐库）
+func checkDiskSpace(dir string, need, written int64) *downloadError {
+	minFree, maxLibrary := minFreeSpace.Load(), maxLibrarySize.Load()
+	if free, err := diskFree(dir); err == nil {
+		if need > free || (minFree > 0 && free-need < minFree) {
+			return &downloadError{
+				Type:    errTypeDiskFull,
+				Message: fmt.Sprintf("磁盘剩余空间不足（剩余 %d MB，保留 %d MB）", free/mb, minFree/mb),
+			}
+		}
+	}
+
+	if maxLibrary > 0 {
+		if used := librarySize() + written + need; used > maxLibrary {
+			return &downloadError{
+				Type:    errTypeQuotaExceeded,
+				Message: fmt.Sprintf("超出音乐库容量上限（%d MB）", maxLibrary/mb),
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+
+package controllers
+
+import (
+	"errors"
+	"syscall"
+)
+
+// diskFree 获取路径所在磁盘的可用空间（字节）
+func diskFree(path string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
+
+// isNoSpace 判断写入错误是否由磁盘已满导致
+func isNoSpace(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
@@ -0,0 +1,31 @@
+//go:build windows
+
+package controllers
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+)
+
+var procGetDiskFreeSpaceExW = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// diskFree 获取路径所在磁盘的可用空间（字节）
+func diskFree(path string) (int64, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var free uint64
+	r, _, e := procGetDiskFreeSpaceExW.Call(uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&free)), 0, 0)
+	if r == 0 {
+		return 0, e
+	}
+	return int64(free), nil
+}
+
+// isNoSpace 判断写入错误是否由磁盘已满导致
+func isNoSpace(err error) bool {
+	// ERROR_DISK_FULL / ERROR_HANDLE_DISK_FULL
+	return errors.Is(err, syscall.Errno(112)) || errors.Is(err, syscall.Errno(39))
+}
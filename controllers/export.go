@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"yinyue/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportSong 待导出的歌曲
+type exportSong struct {
+	Source string `json:"source"`
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Artist string `json:"artist"`
+	File   string `json:"file,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// exportManifest 压缩包内的清单
+type exportManifest struct {
+	Name     string       `json:"name"`
+	Time     string       `json:"time"`
+	Included []exportSong `json:"included"`
+	Missing  []exportSong `json:"missing"`
+}
+
+// writeZipExport 以流式方式输出压缩包，不在内存中缓存整个文件
+func writeZipExport(c *gin.Context, name string, songs []exportSong) {
+	libMutex.RLock()
+	library := make(map[string]DownloadedSong, len(downloadedSongs))
+	for _, song := range downloadedSongs {
+		library[song.Source+"_"+song.ID] = song
+	}
+	libMutex.RUnlock()
+
+	manifest := exportManifest{
+		Name:     name,
+		Time:     time.Now().Format("2006-01-02 15:04:05"),
+		Included: []exportSong{},
+		Missing:  []exportSong{},
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", "attachment; filename*=UTF-8''"+url.PathEscape(sanitizeFilename(name)+".zip"))
+	c.Status(200)
+
+	zw := zip.NewWriter(c.Writer)
+	defer zw.Close()
+
+	var entries []m3uEntry
+	used := make(map[string]bool)
+	for _, s := range songs {
+		song, ok := library[s.Source+"_"+s.ID]
+		if !ok {
+			s.Reason = "未下载"
+			manifest.Missing = append(manifest.Missing, s)
+			continue
+		}
+
+		file, err := os.Open(song.Path)
+		if err != nil {
+			s.Reason = "文件不存在"
+			manifest.Missing = append(manifest.Missing, s)
+			continue
+		}
+
+		entryName := uniqueZipName(used, filepath.Base(song.Path))
+		err = copyToZip(zw, entryName, file)
+		file.Close()
+		if err != nil {
+			// 客户端断开或写入失败，无法继续输出
+			log.Printf("导出压缩包失败: %v", err)
+			return
+		}
+
+		s.File = entryName
+		s.Name = song.Name
+		s.Artist = song.Artist
+		manifest.Included = append(manifest.Included, s)
+		entries = append(entries, m3uEntry{Artist: song.Artist, Title: song.Name, Duration: song.Duration, Location: entryName})
+	}
+
+	if w, err := zw.Create(sanitizeFilename(name) + ".m3u8"); err == nil {
+		io.WriteString(w, buildM3U(name, entries))
+	}
+	if w, err := zw.Create("manifest.json"); err == nil {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(manifest)
+	}
+}
+
+// copyToZip 将文件以不压缩方式写入压缩包（音频本身已压缩）
+func copyToZip(zw *zip.Writer, name string, file *os.File) error {
+	header := &zip.FileHeader{Name: name, Method: zip.Store}
+	if info, err := file.Stat(); err == nil {
+		header.Modified = info.ModTime()
+	}
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// uniqueZipName 避免压缩包内文件重名
+func uniqueZipName(used map[string]bool, name string) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := name
+	for i := 2; used[candidate]; i++ {
+		candidate = base + " (" + strconv.Itoa(i) + ")" + ext
+	}
+	used[candidate] = true
+	return candidate
+}
+
+// exportPlaylistZip 打包下载歌单中已下载的歌曲
+func exportPlaylistZip(c *gin.Context) {
+	source := c.Param("source")
+	id := strings.TrimSuffix(c.Param("id"), ".zip")
+
+	playlist, ok := storage.GetPlaylist(id, source)
+	if !ok {
+		c.JSON(404, gin.H{"code": 404, "message": "歌单不存在"})
+		return
+	}
+
+	songs := make([]exportSong, len(playlist.Songs))
+	for i, s := range playlist.Songs {
+		songs[i] = exportSong{Source: s.Source, ID: s.ID, Name: s.Name, Artist: s.Artist}
+	}
+
+	name := playlist.Name
+	if name == "" {
+		name = source + "_" + id
+	}
+	writeZipExport(c, name, songs)
+}
+
+// ExportLibraryZip 打包下载音乐库中某个艺术家或专辑的歌曲
+func ExportLibraryZip(c *gin.Context) {
+	artist := c.Query("artist")
+	album := c.Query("album")
+	if artist == "" && album == "" {
+		c.JSON(400, gin.H{"code": 400, "message": "缺少参数"})
+		return
+	}
+
+	var songs []exportSong
+	for _, song := range storage.GetLibrary() {
+		if (artist != "" && song.Artist != artist) || (album != "" && song.Album != album) {
+			continue
+		}
+		songs = append(songs, exportSong{Source: song.Source, ID: song.ID, Name: song.Name, Artist: song.Artist})
+	}
+
+	name := strings.Trim(artist+" - "+album, " -")
+	writeZipExport(c, name, songs)
+}
+
+// ExportSelectionZip 打包下载任意选择的歌曲
+func ExportSelectionZip(c *gin.Context) {
+	var req struct {
+		Name  string       `json:"name"`
+		Songs []exportSong `json:"songs"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Songs) == 0 {
+		c.JSON(400, gin.H{"code": 400, "message": "参数错误"})
+		return
+	}
+	if req.Name == "" {
+		req.Name = "TuneHub-" + time.Now().Format("20060102-150405")
+	}
+
+	for i := range req.Songs {
+		req.Songs[i].File = ""
+		req.Songs[i].Reason = ""
+	}
+	writeZipExport(c, req.Name, req.Songs)
+}
@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"yinyue/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// unhealthyThreshold 上游连续失败达到该次数后进入离线模式
+const unhealthyThreshold = 3
+
+// healthProbeInterval 离线模式下探测上游是否恢复的间隔
+const healthProbeInterval = 30 * time.Second
+
+// errUpstreamOffline 上游不可用且没有缓存数据
+var errUpstreamOffline = errors.New("上游服务不可用")
+
+// UpstreamHealth 上游健康状态
+type UpstreamHealth struct {
+	Healthy   bool   `json:"healthy"`
+	Failures  int    `json:"failures"` // 连续失败次数
+	LastError string `json:"lastError,omitempty"`
+	Since     string `json:"since"`     // 进入当前状态的时间
+	LastCheck string `json:"lastCheck"` // 最近一次请求上游的时间
+	Waiting   int    `json:"waiting"`   // 等待上游恢复后下载的任务数
+	// 熔断中或有失败记录的音源
+	Sources []SourceBreaker `json:"sources"`
+}
+
+var (
+	upstreamHealth = UpstreamHealth{
+		Healthy: true,
+		Since:   time.Now().Format("2006-01-02 15:04:05"),
+	}
+	healthMutex sync.RWMutex
+)
+
+// upstreamHealthy 上游当前是否可用
+func upstreamHealthy() bool {
+	healthMutex.RLock()
+	defer healthMutex.RUnlock()
+	return upstreamHealth.Healthy
+}
+
+// recordUpstreamSuccess 记录一次成功的上游请求，从离线恢复时继续等待中的下载
+func recordUpstreamSuccess() {
+	now := time.Now().Format("2006-01-02 15:04:05")
+
+	healthMutex.Lock()
+	recovered := !upstreamHealth.Healthy
+	upstreamHealth.Failures = 0
+	upstreamHealth.LastCheck = now
+	if recovered {
+		upstreamHealth.Healthy = true
+		upstreamHealth.LastError = ""
+		upstreamHealth.Since = now
+	}
+	healthMutex.Unlock()
+
+	if recovered {
+		log.Printf("上游服务已恢复")
+		go resumeWaitingDownloads()
+	}
+}
+
+// recordUpstreamFailure 记录一次无法连接上游的请求，连续失败过多时进入离线模式
+func recordUpstreamFailure(reason string) {
+	upstreamFailed(reason, false)
+}
+
+// markUpstreamOffline 所有音源都不可用时直接进入离线模式
+func markUpstreamOffline(reason string) {
+	upstreamFailed(reason, true)
+}
+
+// upstreamFailed 记录上游失败，force 为 true 时不等失败次数达到阈值直接进入离线模式
+func upstreamFailed(reason string, force bool) {
+	now := time.Now().Format("2006-01-02 15:04:05")
+
+	healthMutex.Lock()
+	upstreamHealth.Failures++
+	upstreamHealth.LastError = reason
+	upstreamHealth.LastCheck = now
+	offline := upstreamHealth.Healthy && (force || upstreamHealth.Failures >= unhealthyThreshold)
+	if offline {
+		upstreamHealth.Healthy = false
+		upstreamHealth.Since = now
+	}
+	healthMutex.Unlock()
+
+	switch {
+	case offline && force:
+		log.Printf("所有音源都不可用，进入离线模式: %s", reason)
+	case offline:
+		log.Printf("上游服务连续 %d 次请求失败，进入离线模式: %s", unhealthyThreshold, reason)
+	}
+}
+
+// upstreamUnavailable 判断错误是否由上游不可用导致（而非业务错误或数据格式异常）
+func upstreamUnavailable(err error) bool {
+	var upErr *upstreamError
+	if errors.As(err, &upErr) {
+		return upErr.Status >= 500
+	}
+	return errors.Is(err, errUpstreamRequest) || errors.Is(err, errUpstreamTimeout) ||
+		errors.Is(err, errUpstreamOffline) || errors.Is(err, errSourceUnavailable)
+}
+
+// startHealthMonitor 离线模式下定期探测上游，恢复后自动继续等待中的下载
+func startHealthMonitor() {
+	go func() {
+		ticker := time.NewTicker(healthProbeInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if !upstreamHealthy() {
+				probeUpstream()
+			}
+		}
+	}()
+}
+
+// probeUpstream 依次请求各音源的排行榜列表探测上游是否可用，结果由 getUpstream 记录
+// 单个音源故障不应让整个上游一直处于离线模式，任一音源响应即视为恢复
+func probeUpstream() {
+	for _, source := range matchSources {
+		params := url.Values{}
+		params.Set("source", source)
+		params.Set("type", "toplists")
+		if status, _, err := getUpstream(upstreamClient, params); err == nil && status < 500 {
+			return
+		}
+	}
+}
+
+// GetUpstreamHealth 获取上游健康状态
+func GetUpstreamHealth(c *gin.Context) {
+	healthMutex.RLock()
+	health := upstreamHealth
+	healthMutex.RUnlock()
+
+	waitingMutex.Lock()
+	health.Waiting = len(waitingDownloads)
+	waitingMutex.Unlock()
+	health.Sources = sourceBreakers()
+
+	c.JSON(200, models.Success(health))
+}
@@ -0,0 +1,491 @@
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"yinyue/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportFileSize 导入文件大小上限（Apple Music 的 Library.xml 可能有几十 MB）
+const maxImportFileSize = 64 << 20
+
+// maxImportJobs 内存中保留的导入任务数
+const maxImportJobs = 50
+
+// importSlots 同一时间只运行一个导入任务，一次上传多个歌单时依次匹配
+var importSlots = make(chan struct{}, 1)
+
+// reviewCandidates 待确认条目中保留的候选歌曲数
+const reviewCandidates = 3
+
+// errEmptyImport 文件中没有可识别的歌曲
+var errEmptyImport = errors.New("文件中没有可识别的歌曲")
+
+// importFormatNames 导入格式的显示名称
+var importFormatNames = map[string]string{
+	"m3u":       "M3U 文件",
+	"csv":       "CSV 文件",
+	"text":      "文本列表",
+	"exportify": "Spotify (Exportify)",
+	"applexml":  "Apple Music 资料库",
+}
+
+// titleSeparator 文本列表中艺术家与歌名之间的分隔符
+var titleSeparator = regexp.MustCompile(`\s+[-–—]\s+`)
+
+// importList 解析得到的待导入歌单
+type importList struct {
+	Name    string
+	Entries []matchQuery
+}
+
+// ImportMatch 单首歌曲的匹配结果
+type ImportMatch struct {
+	Index      int                   `json:"index"` // 在原文件中的顺序，从 0 开始
+	Query      matchQuery            `json:"query"`
+	Status     string                `json:"status"` // matched, review, unmatched
+	Score      float64               `json:"score"`
+	Song       *storage.PlaylistSong `json:"song,omitempty"`
+	Candidates []matchCandidate      `json:"candidates,omitempty"`
+	Error      string                `json:"error,omitempty"`
+}
+
+// ImportJob 文件导入任务
+type ImportJob struct {
+	ID         string        `json:"id"`
+	Name       string        `json:"name"`
+	Format     string        `json:"format"`
+	Status     string        `json:"status"` // pending, running, done, failed
+	Total      int           `json:"total"`
+	Done       int           `json:"done"`
+	PlaylistID string        `json:"playlistId,omitempty"`
+	Matched    []ImportMatch `json:"matched"`
+	Review     []ImportMatch `json:"review"` // 低置信度和未匹配的条目，需人工确认
+	Error      string        `json:"error,omitempty"`
+	StartTime  string        `json:"startTime"`
+	EndTime    string        `json:"endTime,omitempty"`
+}
+
+var (
+	importJobs     = make(map[string]*ImportJob)
+	importJobOrder []string
+	importMutex    sync.RWMutex
+)
+
+// detectImportFormat 根据扩展名和内容判断文件格式
+func detectImportFormat(filename string, data []byte) string {
+	trimmed := bytes.TrimSpace(data)
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".m3u", ".m3u8":
+		return "m3u"
+	case ".csv":
+		if isExportifyCSV(data) {
+			return "exportify"
+		}
+		return "csv"
+	case ".xml":
+		return "applexml"
+	}
+	if bytes.HasPrefix(trimmed, []byte("#EXTM3U")) {
+		return "m3u"
+	}
+	if bytes.HasPrefix(trimmed, []byte("<?xml")) && bytes.Contains(trimmed, []byte("<plist")) {
+		return "applexml"
+	}
+	return "text"
+}
+
+// parseImportFile 按格式解析导入文件
+func parseImportFile(format, filename string, data []byte) ([]importList, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	name := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+
+	var entries []matchQuery
+	var err error
+	switch format {
+	case "exportify":
+		return parseExportifyCSV(name, data)
+	case "applexml":
+		return parseAppleLibrary(data)
+	case "m3u":
+		entries = parseM3UEntries(data)
+	case "csv":
+		entries, err = parseCSVEntries(data)
+	default:
+		entries = parseTextEntries(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errEmptyImport
+	}
+	return []importList{{Name: name, Entries: entries}}, nil
+}
+
+// splitArtistTitle 拆分 "艺术家 - 歌名"，没有分隔符时整行作为歌名
+func splitArtistTitle(line string) matchQuery {
+	parts := titleSeparator.Split(strings.TrimSpace(line), 2)
+	if len(parts) == 2 {
+		return matchQuery{Artist: strings.TrimSpace(parts[0]), Title: strings.TrimSpace(parts[1])}
+	}
+	return matchQuery{Title: strings.TrimSpace(line)}
+}
+
+// parseM3UEntries 解析 M3U，优先使用 #EXTINF 信息，否则使用文件名
+func parseM3UEntries(data []byte) []matchQuery {
+	var entries []matchQuery
+	var pending *matchQuery
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXTINF:"):
+			if _, info, ok := strings.Cut(line, ","); ok && strings.TrimSpace(info) != "" {
+				q := splitArtistTitle(info)
+				pending = &q
+			}
+		case strings.HasPrefix(line, "#"):
+			continue
+		default:
+			if pending != nil {
+				entries = append(entries, *pending)
+				pending = nil
+				continue
+			}
+			base := line
+			if u, err := urlPathBase(line); err == nil {
+				base = u
+			}
+			base = strings.TrimSuffix(base, filepath.Ext(base))
+			if base != "" {
+				entries = append(entries, splitArtistTitle(base))
+			}
+		}
+	}
+	return entries
+}
+
+// urlPathBase 取出路径或地址中的文件名
+func urlPathBase(location string) (string, error) {
+	location = strings.ReplaceAll(location, "\\", "/")
+	if i := strings.IndexAny(location, "?#"); i >= 0 && strings.Contains(location, "://") {
+		location = location[:i]
+	}
+	base := filepath.Base(location)
+	if base == "." || base == "/" {
+		return "", errors.New("无效路径")
+	}
+	return base, nil
+}
+
+// csvColumns 常见的表头名称
+var csvColumns = map[string][]string{
+	"title":  {"title", "name", "song", "track", "track name", "歌名", "歌曲", "歌曲名", "标题"},
+	"artist": {"artist", "artists", "singer", "artist name(s)", "artist name", "歌手", "艺术家", "演唱"},
+	"album":  {"album", "album name", "专辑"},
+}
+
+// parseCSVEntries 解析 CSV，识别表头；没有表头时按 歌名,艺术家,专辑 的顺序读取
+func parseCSVEntries(data []byte) ([]matchQuery, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, errors.New("CSV 格式错误")
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := map[string]int{"title": 0, "artist": 1, "album": 2}
+	if header, ok := csvHeader(records[0]); ok {
+		columns = header
+		records = records[1:]
+	}
+
+	var entries []matchQuery
+	for _, record := range records {
+		q := matchQuery{
+			Title:  csvField(record, columns["title"]),
+			Artist: csvField(record, columns["artist"]),
+			Album:  csvField(record, columns["album"]),
+		}
+		if q.Title == "" {
+			continue
+		}
+		entries = append(entries, q)
+	}
+	return entries, nil
+}
+
+// csvHeader 识别表头，返回各字段所在列
+func csvHeader(row []string) (map[string]int, bool) {
+	columns := map[string]int{"title": -1, "artist": -1, "album": -1}
+	for i, cell := range row {
+		cell = strings.ToLower(strings.TrimSpace(cell))
+		for field, names := range csvColumns {
+			if columns[field] >= 0 {
+				continue
+			}
+			for _, name := range names {
+				if cell == name {
+					columns[field] = i
+				}
+			}
+		}
+	}
+	return columns, columns["title"] >= 0
+}
+
+// csvField 安全读取 CSV 字段
+func csvField(record []string, i int) string {
+	if i < 0 || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+// parseTextEntries 解析 "艺术家 - 歌名" 文本列表，忽略空行和 # 开头的注释
+func parseTextEntries(data []byte) []matchQuery {
+	var entries []matchQuery
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, splitArtistTitle(line))
+	}
+	return entries
+}
+
+// startImportJob 创建导入任务并在后台匹配
+func startImportJob(list importList, format string, sources []string) *ImportJob {
+	job := &ImportJob{
+		ID:        newID(),
+		Name:      list.Name,
+		Format:    format,
+		Status:    "pending",
+		Total:     len(list.Entries),
+		Matched:   []ImportMatch{},
+		Review:    []ImportMatch{},
+		StartTime: time.Now().Format("2006-01-02 15:04:05"),
+	}
+
+	importMutex.Lock()
+	importJobs[job.ID] = job
+	importJobOrder = append(importJobOrder, job.ID)
+	if len(importJobOrder) > maxImportJobs {
+		delete(importJobs, importJobOrder[0])
+		importJobOrder = importJobOrder[1:]
+	}
+	importMutex.Unlock()
+
+	go runImportJob(job, list.Entries, sources)
+	return job
+}
+
+// runImportJob 逐首搜索匹配，完成后创建本地歌单
+func runImportJob(job *ImportJob, entries []matchQuery, sources []string) {
+	importSlots <- struct{}{}
+	defer func() { <-importSlots }()
+
+	importMutex.Lock()
+	job.Status = "running"
+	importMutex.Unlock()
+
+	for i, q := range entries {
+		match := matchEntry(i, q, sources)
+
+		importMutex.Lock()
+		job.Done++
+		if match.Status == "matched" {
+			job.Matched = append(job.Matched, match)
+		} else {
+			job.Review = append(job.Review, match)
+		}
+		importMutex.Unlock()
+	}
+
+	importMutex.RLock()
+	songs := make([]storage.PlaylistSong, 0, len(job.Matched))
+	for _, m := range job.Matched {
+		songs = append(songs, *m.Song)
+	}
+	importMutex.RUnlock()
+
+	playlist := storage.Playlist{
+		ID:          newID(),
+		Source:      storage.LocalSource,
+		Name:        job.Name,
+		Author:      "本地",
+		Description: "从 " + importFormatNames[job.Format] + " 导入",
+		Songs:       songs,
+	}
+	err := storage.AddPlaylist(playlist)
+	if err == nil {
+		playlistChanged(playlist.Source, playlist.ID)
+	} else {
+		log.Printf("保存导入歌单失败: %v", err)
+	}
+
+	importMutex.Lock()
+	if err != nil {
+		job.Status = "failed"
+		job.Error = "保存歌单失败"
+	} else {
+		job.Status = "done"
+		job.PlaylistID = playlist.ID
+	}
+	job.EndTime = time.Now().Format("2006-01-02 15:04:05")
+	importMutex.Unlock()
+}
+
+// matchEntry 搜索单首歌曲并按分数分类
+func matchEntry(index int, q matchQuery, sources []string) ImportMatch {
+	match := ImportMatch{Index: index, Query: q, Status: "unmatched"}
+
+	candidates, err := findMatches(q, sources)
+	if err != nil {
+		match.Error = err.Error()
+		return match
+	}
+	if len(candidates) == 0 {
+		return match
+	}
+
+	best := candidates[0]
+	match.Score = best.Score
+	song := storage.PlaylistSong{
+		ID:       best.ID,
+		Source:   best.Source,
+		Name:     best.Name,
+		Artist:   best.Artist,
+		Album:    best.Album,
+		Types:    best.Types,
+		Duration: best.Duration,
+	}
+	match.Song = &song
+	switch {
+	case best.Score >= matchThreshold:
+		match.Status = "matched"
+	case best.Score >= reviewThreshold:
+		match.Status = "review"
+	}
+
+	if match.Status != "matched" {
+		if len(candidates) > reviewCandidates {
+			candidates = candidates[:reviewCandidates]
+		}
+		match.Candidates = candidates
+	}
+	return match
+}
+
+// importSources 解析请求中的音源列表，未指定时搜索全部音源
+func importSources(value string) []string {
+	if value == "" {
+		return matchSources
+	}
+	var sources []string
+	for _, s := range strings.Split(value, ",") {
+		s = strings.TrimSpace(s)
+		for _, known := range matchSources {
+			if s == known {
+				sources = append(sources, s)
+			}
+		}
+	}
+	if len(sources) == 0 {
+		return matchSources
+	}
+	return sources
+}
+
+// ImportPlaylistFile 上传 M3U、CSV、文本列表、Exportify CSV 或 Apple Music Library.xml，
+// 搜索匹配后生成本地歌单（Library.xml 中每个歌单对应一个导入任务）
+func ImportPlaylistFile(c *gin.Context) {
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(400, gin.H{"code": 400, "message": "缺少文件"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxImportFileSize+1))
+	if err != nil {
+		c.JSON(400, gin.H{"code": 400, "message": "读取文件失败"})
+		return
+	}
+	if len(data) > maxImportFileSize {
+		c.JSON(400, gin.H{"code": 400, "message": "文件过大"})
+		return
+	}
+
+	format := c.PostForm("format")
+	if _, ok := importFormatNames[format]; !ok {
+		format = detectImportFormat(header.Filename, data)
+	}
+
+	lists, err := parseImportFile(format, header.Filename, data)
+	if err != nil {
+		c.JSON(400, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+
+	sources := importSources(c.PostForm("sources"))
+	jobs := make([]*ImportJob, 0, len(lists))
+	for _, list := range lists {
+		if name := strings.TrimSpace(c.PostForm("name")); name != "" && len(lists) == 1 {
+			list.Name = name
+		}
+		jobs = append(jobs, startImportJob(list, format, sources))
+	}
+
+	importMutex.RLock()
+	defer importMutex.RUnlock()
+	c.JSON(200, gin.H{"code": 200, "message": "导入任务已启动", "data": jobs})
+}
+
+// GetImportJob 获取导入任务进度和匹配结果
+func GetImportJob(c *gin.Context) {
+	importMutex.RLock()
+	defer importMutex.RUnlock()
+
+	job, ok := importJobs[c.Param("id")]
+	if !ok {
+		c.JSON(404, gin.H{"code": 404, "message": "任务不存在"})
+		return
+	}
+	c.JSON(200, gin.H{"code": 200, "data": job})
+}
+
+// GetImportJobs 获取最近的导入任务
+func GetImportJobs(c *gin.Context) {
+	importMutex.RLock()
+	defer importMutex.RUnlock()
+
+	jobs := make([]*ImportJob, 0, len(importJobOrder))
+	for i := len(importJobOrder) - 1; i >= 0; i-- {
+		jobs = append(jobs, importJobs[importJobOrder[i]])
+	}
+	c.JSON(200, gin.H{"code": 200, "data": jobs})
+}
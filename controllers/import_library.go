@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// exportifyHeaders Exportify 导出文件特有的表头
+var exportifyHeaders = []string{"track uri", "spotify id"}
+
+// isExportifyCSV 判断 CSV 是否为 Exportify 导出的 Spotify 歌单
+func isExportifyCSV(data []byte) bool {
+	line, _, _ := bytes.Cut(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), []byte("\n"))
+	record, err := csv.NewReader(bytes.NewReader(line)).Read()
+	if err != nil {
+		return false
+	}
+	for _, cell := range record {
+		cell = strings.ToLower(strings.TrimSpace(cell))
+		for _, h := range exportifyHeaders {
+			if cell == h {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseExportifyCSV 解析 Exportify CSV，歌单名取自文件名
+func parseExportifyCSV(name string, data []byte) ([]importList, error) {
+	entries, err := parseCSVEntries(data)
+	if err != nil {
+		return nil, err
+	}
+	// Exportify 用下划线代替文件名中的空格
+	return []importList{{Name: strings.ReplaceAll(name, "_", " "), Entries: entries}}, nil
+}
+
+// plistDict Apple plist 中的 dict
+type plistDict map[string]interface{}
+
+// parsePlist 解析 XML plist，返回 plistDict、[]interface{}、string、int64、bool 组成的值
+func parsePlist(r io.Reader) (interface{}, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local != "plist" {
+			return parsePlistValue(decoder, start)
+		}
+	}
+}
+
+// parsePlistValue 解析一个 plist 元素
+func parsePlistValue(decoder *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	switch start.Name.Local {
+	case "dict":
+		dict := plistDict{}
+		var key string
+		for {
+			tok, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				if t.Name.Local == "key" {
+					if err := decoder.DecodeElement(&key, &t); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				value, err := parsePlistValue(decoder, t)
+				if err != nil {
+					return nil, err
+				}
+				dict[key] = value
+			case xml.EndElement:
+				return dict, nil
+			}
+		}
+	case "array":
+		var array []interface{}
+		for {
+			tok, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				value, err := parsePlistValue(decoder, t)
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, value)
+			case xml.EndElement:
+				return array, nil
+			}
+		}
+	case "true", "false":
+		if err := decoder.Skip(); err != nil {
+			return nil, err
+		}
+		return start.Name.Local == "true", nil
+	case "integer":
+		var s string
+		if err := decoder.DecodeElement(&s, &start); err != nil {
+			return nil, err
+		}
+		n, _ := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		return n, nil
+	default:
+		// string、date、data、real 等按字符串处理
+		var s string
+		if err := decoder.DecodeElement(&s, &start); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+}
+
+// getString 读取 dict 中的字符串
+func (d plistDict) getString(key string) string {
+	s, _ := d[key].(string)
+	return s
+}
+
+// getBool 读取 dict 中的布尔值
+func (d plistDict) getBool(key string) bool {
+	b, _ := d[key].(bool)
+	return b
+}
+
+// getInt 读取 dict 中的整数
+func (d plistDict) getInt(key string) int64 {
+	n, _ := d[key].(int64)
+	return n
+}
+
+// parseAppleLibrary 解析 Apple Music / iTunes 导出的 Library.xml，每个用户歌单生成一个导入列表
+// 资料库、文件夹以及“音乐”“播客”等系统歌单会被跳过
+func parseAppleLibrary(data []byte) ([]importList, error) {
+	value, err := parsePlist(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.New("Library.xml 格式错误")
+	}
+	root, ok := value.(plistDict)
+	if !ok {
+		return nil, errors.New("Library.xml 格式错误")
+	}
+
+	tracks := map[int64]matchQuery{}
+	if trackDict, ok := root["Tracks"].(plistDict); ok {
+		for _, v := range trackDict {
+			track, ok := v.(plistDict)
+			if !ok {
+				continue
+			}
+			tracks[track.getInt("Track ID")] = matchQuery{
+				Title:  track.getString("Name"),
+				Artist: track.getString("Artist"),
+				Album:  track.getString("Album"),
+			}
+		}
+	}
+
+	playlists, _ := root["Playlists"].([]interface{})
+	var lists []importList
+	for _, v := range playlists {
+		playlist, ok := v.(plistDict)
+		if !ok {
+			continue
+		}
+		if playlist.getBool("Master") || playlist.getBool("Folder") ||
+			playlist.getInt("Distinguished Kind") != 0 {
+			continue
+		}
+		if visible, ok := playlist["Visible"].(bool); ok && !visible {
+			continue
+		}
+
+		items, _ := playlist["Playlist Items"].([]interface{})
+		list := importList{Name: playlist.getString("Name")}
+		for _, item := range items {
+			ref, ok := item.(plistDict)
+			if !ok {
+				continue
+			}
+			if q, ok := tracks[ref.getInt("Track ID")]; ok && q.Title != "" {
+				list.Entries = append(list.Entries, q)
+			}
+		}
+		if len(list.Entries) > 0 {
+			lists = append(lists, list)
+		}
+	}
+
+	if len(lists) == 0 {
+		return nil, errEmptyImport
+	}
+	return lists, nil
+}
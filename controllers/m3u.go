@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"yinyue/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// autoM3UEnabled 歌单变化时是否自动写入 .m3u8 文件到下载目录
+var autoM3UEnabled atomic.Bool
+
+// m3uEntry M3U 播放列表条目
+type m3uEntry struct {
+	Artist   string
+	Title    string
+	Duration int // 秒，未知为 0
+	Location string
+}
+
+// buildM3U 生成扩展 M3U 内容
+func buildM3U(name string, entries []m3uEntry) string {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	if name != "" {
+		b.WriteString("#PLAYLIST:" + name + "\n")
+	}
+	for _, e := range entries {
+		// 扩展 M3U 约定时长未知时写 -1
+		duration := e.Duration
+		if duration <= 0 {
+			duration = -1
+		}
+		fmt.Fprintf(&b, "#EXTINF:%d,%s - %s\n", duration, e.Artist, e.Title)
+		b.WriteString(e.Location + "\n")
+	}
+	return b.String()
+}
+
+// m3uExporter 根据导出模式生成条目位置
+type m3uExporter struct {
+	mode    string // path: 相对下载目录的文件路径; url: 播放地址
+	baseURL string // url 模式下的服务地址
+	br      string
+	library map[string]DownloadedSong
+}
+
+func newM3UExporter(c *gin.Context, mode string) *m3uExporter {
+	e := &m3uExporter{mode: mode, br: storage.GetSettings().Quality}
+	if c != nil {
+		scheme := "http"
+		if c.Request.TLS != nil {
+			scheme = "https"
+		}
+		if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+			scheme = proto
+		}
+		e.baseURL = scheme + "://" + c.Request.Host
+	}
+
+	libMutex.RLock()
+	e.library = make(map[string]DownloadedSong, len(downloadedSongs))
+	for _, song := range downloadedSongs {
+		e.library[song.Source+"_"+song.ID] = song
+	}
+	libMutex.RUnlock()
+	return e
+}
+
+// entry 生成单首歌曲的条目，path 模式下未下载的歌曲返回 false
+// 时长优先使用音乐库中记录的值，duration 为调用方已知的时长
+func (e *m3uExporter) entry(source, id, name, artist string, duration int) (m3uEntry, bool) {
+	item := m3uEntry{Artist: artist, Title: name, Duration: duration}
+	song, downloaded := e.library[source+"_"+id]
+	if downloaded && song.Duration > 0 {
+		item.Duration = song.Duration
+	}
+
+	if e.mode == "url" {
+		if downloaded {
+			item.Location = e.baseURL + "/api/v1/library/" + url.PathEscape(source) + "/" + url.PathEscape(id) + "/stream"
+		} else {
+			params := url.Values{}
+			params.Set("source", source)
+			params.Set("id", id)
+			params.Set("br", e.br)
+			item.Location = e.baseURL + "/api/v1/stream?" + params.Encode()
+		}
+		return item, true
+	}
+
+	if !downloaded {
+		return item, false
+	}
+	rel, err := filepath.Rel(DownloadDir, song.Path)
+	if err != nil {
+		rel = song.Path
+	}
+	item.Location = filepath.ToSlash(rel)
+	return item, true
+}
+
+// playlist 生成歌单的全部条目
+func (e *m3uExporter) playlist(p storage.Playlist) []m3uEntry {
+	entries := make([]m3uEntry, 0, len(p.Songs))
+	for _, s := range p.Songs {
+		if item, ok := e.entry(s.Source, s.ID, s.Name, s.Artist, s.Duration); ok {
+			entries = append(entries, item)
+		}
+	}
+	return entries
+}
+
+// exportMode 读取导出模式参数
+func exportMode(c *gin.Context) (string, bool) {
+	mode := c.DefaultQuery("mode", "path")
+	return mode, mode == "path" || mode == "url"
+}
+
+// writeM3U 输出 M3U 下载
+func writeM3U(c *gin.Context, filename, content string) {
+	c.Header("Content-Disposition", "attachment; filename*=UTF-8''"+url.PathEscape(filename))
+	c.Data(200, "audio/x-mpegurl; charset=utf-8", []byte(content))
+}
+
+// ExportLibraryM3U 导出音乐库（可按艺术家、专辑筛选）为 M3U 播放列表
+func ExportLibraryM3U(c *gin.Context) {
+	artist := c.Query("artist")
+	album := c.Query("album")
+	mode, ok := exportMode(c)
+	if !ok {
+		c.JSON(400, gin.H{"code": 400, "message": "参数错误"})
+		return
+	}
+
+	exporter := newM3UExporter(c, mode)
+	songs := storage.GetLibrary()
+
+	name := "音乐库"
+	switch {
+	case artist != "" && album != "":
+		name = artist + " - " + album
+	case artist != "":
+		name = artist
+	case album != "":
+		name = album
+	}
+
+	entries := make([]m3uEntry, 0, len(songs))
+	for _, song := range songs {
+		if (artist != "" && song.Artist != artist) || (album != "" && song.Album != album) {
+			continue
+		}
+		if item, ok := exporter.entry(song.Source, song.ID, song.Name, song.Artist, song.Duration); ok {
+			entries = append(entries, item)
+		}
+	}
+
+	writeM3U(c, sanitizeFilename(name)+".m3u8", buildM3U(name, entries))
+}
+
+// m3uFilename 歌单对应的 .m3u8 文件名，带上来源和ID，避免同名歌单互相覆盖
+func m3uFilename(p storage.Playlist) string {
+	if p.Name == "" {
+		return m3uSuffix(p.Source, p.ID)
+	}
+	return sanitizeFilename(p.Name) + " " + m3uSuffix(p.Source, p.ID)
+}
+
+// m3uSuffix 文件名中标识歌单的部分
+func m3uSuffix(source, id string) string {
+	return sanitizeFilename("("+source+"_"+id+")") + ".m3u8"
+}
+
+// playlistChanged 歌单变化后按设置重新生成下载目录中的 .m3u8 文件
+// 歌单改名后按旧名称生成的文件会被删除
+func playlistChanged(source, id string) {
+	if !autoM3UEnabled.Load() {
+		return
+	}
+	playlist, ok := storage.GetPlaylist(id, source)
+	if !ok {
+		return
+	}
+
+	entries := newM3UExporter(nil, "path").playlist(playlist)
+	os.MkdirAll(DownloadDir, 0755)
+	filename := m3uFilename(playlist)
+	path := filepath.Join(DownloadDir, filename)
+	if err := os.WriteFile(path, []byte(buildM3U(playlist.Name, entries)), 0644); err != nil {
+		log.Printf("写入播放列表失败 %s: %v", path, err)
+		return
+	}
+	removeM3UFiles(source, id, filename)
+}
+
+// removeM3UFiles 删除下载目录中属于该歌单的 .m3u8 文件，keep 除外
+func removeM3UFiles(source, id, keep string) {
+	entries, err := os.ReadDir(DownloadDir)
+	if err != nil {
+		return
+	}
+	suffix := m3uSuffix(source, id)
+	for _, e := range entries {
+		name := e.Name()
+		if name != keep && !e.IsDir() && (name == suffix || strings.HasSuffix(name, " "+suffix)) {
+			os.Remove(filepath.Join(DownloadDir, name))
+		}
+	}
+}
+
+// playlistRemoved 删除歌单时一并删除自动生成的 .m3u8 文件
+func playlistRemoved(playlist storage.Playlist) {
+	if !autoM3UEnabled.Load() {
+		return
+	}
+	removeM3UFiles(playlist.Source, playlist.ID, "")
+}
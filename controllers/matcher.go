@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"yinyue/models"
+)
+
+// 匹配置信度阈值：达到 matchThreshold 直接加入歌单，低于 reviewThreshold 视为未匹配
+const (
+	matchThreshold  = 0.85
+	reviewThreshold = 0.5
+)
+
+// matchSources 默认搜索的音源
+var matchSources = []string{"netease", "qq", "kuwo"}
+
+// bracketPattern 括号内的附加信息，如 (Live)、【伴奏】
+var bracketPattern = regexp.MustCompile(`[(（\[【][^)）\]】]*[)）\]】]`)
+
+// artistSeparator 多个艺术家之间的分隔符
+var artistSeparator = regexp.MustCompile(`\s*(?:/|、|,|，|&|;|；|\bfeat\.?|\bft\.?|\band\b)\s*`)
+
+// matchQuery 待匹配的歌曲信息
+type matchQuery struct {
+	Title  string `json:"title"`
+	Artist string `json:"artist"`
+	Album  string `json:"album"`
+}
+
+// matchCandidate 搜索得到的候选歌曲及匹配分数
+type matchCandidate struct {
+	models.Song
+	Score float64 `json:"score"`
+}
+
+// searchSongs 在指定音源中搜索歌曲
+// 返回的缓存情况见 fetchUpstream
+func searchSongs(source, keyword string, limit int) ([]models.Song, cacheResult, error) {
+	params := url.Values{}
+	params.Set("source", source)
+	params.Set("type", "search")
+	params.Set("keyword", keyword)
+	params.Set("limit", strconv.Itoa(limit))
+
+	var data struct {
+		Results *[]upstreamSong `json:"results"`
+	}
+	cache, err := fetchUpstream(searchClient, params, false, &data)
+	if err != nil {
+		return nil, cache, err
+	}
+	if data.Results == nil {
+		return nil, cache, missingField("search", source, "results")
+	}
+	return upstreamSongs("search", source, *data.Results), cache, nil
+}
+
+// findMatches 在多个音源中搜索并按匹配分数排序候选歌曲
+func findMatches(q matchQuery, sources []string) ([]matchCandidate, error) {
+	// 多位艺术家时只用第一位搜索，避免关键词过长搜不到
+	artist := artistSeparator.Split(q.Artist, 2)[0]
+	keyword := strings.TrimSpace(artist + " " + q.Title)
+
+	var (
+		wg         sync.WaitGroup
+		mu         sync.Mutex
+		candidates []matchCandidate
+		failed     int
+	)
+	for _, source := range sources {
+		wg.Add(1)
+		go func(source string) {
+			defer wg.Done()
+			songs, _, err := searchSongs(source, keyword, 10)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed++
+				return
+			}
+			for _, s := range songs {
+				candidates = append(candidates, matchCandidate{Song: s, Score: scoreMatch(q, s)})
+			}
+		}(source)
+	}
+	wg.Wait()
+
+	if failed == len(sources) {
+		return nil, errors.New("搜索失败")
+	}
+
+	// 分数相同时按音源顺序，保证结果稳定
+	sourceOrder := make(map[string]int, len(sources))
+	for i, s := range sources {
+		sourceOrder[s] = i
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		return sourceOrder[candidates[i].Source] < sourceOrder[candidates[j].Source]
+	})
+	return candidates, nil
+}
+
+// scoreMatch 按标题、艺术家、专辑相似度计算匹配分数 (0~1)
+func scoreMatch(q matchQuery, s models.Song) float64 {
+	title := titleSimilarity(q.Title, s.Name)
+	if q.Artist == "" {
+		// 没有艺术家信息时无法确认，分数打折
+		return title * 0.8
+	}
+	artist := artistSimilarity(q.Artist, s.Artist)
+	if q.Album == "" {
+		return title*0.65 + artist*0.35
+	}
+	return title*0.6 + artist*0.3 + similarity(q.Album, s.Album)*0.1
+}
+
+// titleSimilarity 标题相似度，括号内的附加信息不同时只轻微扣分
+func titleSimilarity(a, b string) float64 {
+	full := similarity(a, b)
+	stripped := similarity(bracketPattern.ReplaceAllString(a, ""), bracketPattern.ReplaceAllString(b, "")) * 0.95
+	if stripped > full {
+		return stripped
+	}
+	return full
+}
+
+// artistSimilarity 艺术家相似度，多位艺术家时取最匹配的一位
+func artistSimilarity(a, b string) float64 {
+	best := similarity(a, b)
+	for _, x := range artistSeparator.Split(a, -1) {
+		for _, y := range artistSeparator.Split(b, -1) {
+			if x == "" || y == "" {
+				continue
+			}
+			if s := similarity(x, y); s > best {
+				best = s
+			}
+		}
+	}
+	return best
+}
+
+// similarity 归一化后的编辑距离相似度 (0~1)
+func similarity(a, b string) float64 {
+	ra, rb := normalizeMatch(a), normalizeMatch(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0
+	}
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// normalizeMatch 转为小写并去掉空白和标点
+func normalizeMatch(s string) []rune {
+	var out []rune
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// levenshtein 计算编辑距离
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"math"
+	"testing"
+
+	"yinyue/models"
+)
+
+func TestScoreMatch(t *testing.T) {
+	tests := []struct {
+		name string
+		q    matchQuery
+		s    models.Song
+		want string // match: ≥matchThreshold，review: 待确认，none: 未匹配
+	}{
+		{
+			name: "完全一致",
+			q:    matchQuery{Title: "晴天", Artist: "周杰伦", Album: "叶惠美"},
+			s:    models.Song{Name: "晴天", Artist: "周杰伦", Album: "叶惠美"},
+			want: "match",
+		},
+		{
+			name: "大小写和标点不同",
+			q:    matchQuery{Title: "Hello, World!", Artist: "Some Band"},
+			s:    models.Song{Name: "hello world", Artist: "some band"},
+			want: "match",
+		},
+		{
+			name: "括号内的附加信息不同",
+			q:    matchQuery{Title: "晴天", Artist: "周杰伦"},
+			s:    models.Song{Name: "晴天 (Live)", Artist: "周杰伦"},
+			want: "match",
+		},
+		{
+			name: "多位艺术家取最匹配的一位",
+			q:    matchQuery{Title: "千里之外", Artist: "周杰伦/费玉清"},
+			s:    models.Song{Name: "千里之外", Artist: "周杰伦"},
+			want: "match",
+		},
+		{
+			name: "同名歌曲艺术家不同需要确认",
+			q:    matchQuery{Title: "晴天", Artist: "周杰伦"},
+			s:    models.Song{Name: "晴天", Artist: "林俊杰"},
+			want: "review",
+		},
+		{
+			name: "没有艺术家信息时不自动匹配",
+			q:    matchQuery{Title: "晴天"},
+			s:    models.Song{Name: "晴天", Artist: "周杰伦"},
+			want: "review",
+		},
+		{
+			name: "完全不同",
+			q:    matchQuery{Title: "晴天", Artist: "周杰伦"},
+			s:    models.Song{Name: "Yesterday", Artist: "The Beatles"},
+			want: "none",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score := scoreMatch(tt.q, tt.s)
+			got := "none"
+			switch {
+			case score >= matchThreshold:
+				got = "match"
+			case score >= reviewThreshold:
+				got = "review"
+			}
+			if got != tt.want {
+				t.Errorf("scoreMatch = %.3f (%s), want %s", score, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"", "", 1},
+		{"abc", "", 0},
+		{"abc", "ABC", 1},
+		{"a b-c", "abc", 1},
+		{"abcd", "abce", 0.75},
+		{"晴天", "晴天了", 2.0 / 3},
+	}
+
+	for _, tt := range tests {
+		if got := similarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("similarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -1,16 +1,22 @@
 package controllers
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"io"
+	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"yinyue/models"
 	"yinyue/storage"
 
 	"github.com/gin-gonic/gin"
@@ -20,13 +26,22 @@ const baseURL = "https://music-dl.sayqz.com"
 
 var DownloadDir = "./downloads"
 
+// dataDir 数据目录（缓存等文件存放位置）
+var dataDir = "./data"
+
 // InitLibrary 初始化音乐库（启动时调用）
-func InitLibrary(dataDir string) {
+func InitLibrary(dir string) {
+	dataDir = dir
+
 	// 从存储加载设置
 	settings := storage.GetSettings()
 	if settings.DownloadDir != "" {
 		DownloadDir = settings.DownloadDir
 	}
+	setDiskGuard(settings.MinFreeSpace, settings.MaxLibrarySize)
+	streamCacheEnabled.Store(settings.StreamCache)
+	autoM3UEnabled.Store(settings.AutoM3U)
+	crossSourceEnabled.Store(settings.CrossSource)
 
 	// 从存储加载音乐库
 	songs := storage.GetLibrary()
@@ -42,6 +57,13 @@ func InitLibrary(dataDir string) {
 			Filename: s.Filename,
 			Path:     s.Path,
 			Time:     s.Time,
+			Quality:  s.Quality,
+			Size:     s.Size,
+			Duration: s.Duration,
+
+			MatchSource: s.MatchSource,
+			MatchID:     s.MatchID,
+			MatchScore:  s.MatchScore,
 		}
 	}
 	libMutex.Unlock()
@@ -57,16 +79,22 @@ func ValidateLibrary() int {
 
 	validSongs := make([]DownloadedSong, 0, len(downloadedSongs))
 	removed := 0
+	changed := false
 
 	for _, song := range downloadedSongs {
-		if _, err := os.Stat(song.Path); err == nil {
+		if info, err := os.Stat(song.Path); err == nil {
+			// 补全旧数据缺失的文件大小
+			if song.Size != info.Size() {
+				song.Size = info.Size()
+				changed = true
+			}
 			validSongs = append(validSongs, song)
 		} else {
 			removed++
 		}
 	}
 
-	if removed > 0 {
+	if removed > 0 || changed {
 		downloadedSongs = validSongs
 		// 同步到存储
 		syncLibraryToStorage()
@@ -88,6 +116,13 @@ func syncLibraryToStorage() {
 			Filename: s.Filename,
 			Path:     s.Path,
 			Time:     s.Time,
+			Quality:  s.Quality,
+			Size:     s.Size,
+			Duration: s.Duration,
+
+			MatchSource: s.MatchSource,
+			MatchID:     s.MatchID,
+			MatchScore:  s.MatchScore,
 		}
 	}
 	storage.SetLibrary(songs)
@@ -95,26 +130,83 @@ func syncLibraryToStorage() {
 
 // 下载任务
 type DownloadTask struct {
-	ID       string `json:"id"`
-	Name     string `json:"name"`
-	Artist   string `json:"artist"`
-	Source   string `json:"source"`
-	Status   string `json:"status"` // pending, downloading, success, failed
-	Progress int    `json:"progress"`
-	Error    string `json:"error,omitempty"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Artist    string `json:"artist"`
+	Source    string `json:"source"`
+	Status    string `json:"status"` // pending, waiting（等待上游恢复）, downloading, success, failed
+	Progress  int    `json:"progress"`
+	Retries   int    `json:"retries,omitempty"` // 已重试次数
+	Error     string `json:"error,omitempty"`
+	ErrorType string `json:"errorType,omitempty"`
+	// 原音源不可用、改从其他音源下载时的音源和歌曲ID
+	MatchSource string `json:"matchSource,omitempty"`
+	MatchID     string `json:"matchId,omitempty"`
+
+	duration int // 歌曲时长（秒），下载完成后写入音乐库
+}
+
+// 下载失败的错误类别
+const (
+	errTypeNetwork       = "network"
+	errTypeUpstream      = "upstream"
+	errTypeIO            = "io"
+	errTypeDiskFull      = "disk_full"
+	errTypeQuotaExceeded = "quota_exceeded"
+)
+
+// downloadError 带类别的下载错误
+type downloadError struct {
+	Type    string
+	Message string
+	Status  int         // 上游 HTTP 状态码，网络错误时为 0
+	Header  http.Header // 上游响应头，用于读取 Retry-After
+	Err     error       // 网络错误的原因
+	Resolve bool        // 失败发生在解析播放地址阶段（music-dl API），而非从 CDN 下载文件
+}
+
+func (e *downloadError) Error() string {
+	return e.Message
+}
+
+// fail 将任务标记为失败
+func (t *DownloadTask) fail(err *downloadError) {
+	taskMutex.Lock()
+	t.Status = "failed"
+	t.Error = err.Message
+	t.ErrorType = err.Type
+	taskMutex.Unlock()
 }
 
 // progressWriter 追踪下载进度的 writer
 type progressWriter struct {
-	task    *DownloadTask
-	total   int64
-	written int64
-	file    *os.File
+	task     *DownloadTask
+	total    int64
+	written  int64
+	file     *os.File
+	dir      string
+	checked  int64
+	guardErr *downloadError
+	writeErr error // 写入文件失败，用于区分读取上游失败
 }
 
 func (pw *progressWriter) Write(p []byte) (int, error) {
+	// 定期检查磁盘空间，避免写满磁盘
+	if pw.written-pw.checked >= guardCheckInterval {
+		pw.checked = pw.written
+		need := int64(len(p))
+		if pw.total > pw.written {
+			need = pw.total - pw.written
+		}
+		if err := checkDiskSpace(pw.dir, need, pw.written); err != nil {
+			pw.guardErr = err
+			return 0, err
+		}
+	}
+
 	n, err := pw.file.Write(p)
 	if err != nil {
+		pw.writeErr = err
 		return n, err
 	}
 	pw.written += int64(n)
@@ -137,6 +229,13 @@ type DownloadedSong struct {
 	Filename string `json:"filename"`
 	Path     string `json:"path"`
 	Time     string `json:"time"`
+	Quality  string `json:"quality"`
+	Size     int64  `json:"size"`
+	Duration int    `json:"duration,omitempty"` // 时长（秒），未知为 0
+	// 原音源不可用时实际下载的音源、歌曲ID及匹配分数
+	MatchSource string  `json:"matchSource,omitempty"`
+	MatchID     string  `json:"matchId,omitempty"`
+	MatchScore  float64 `json:"matchScore,omitempty"`
 }
 
 var (
@@ -149,30 +248,32 @@ var (
 func SearchMusic(c *gin.Context) {
 	source := c.Query("source")
 	keyword := c.Query("keyword")
-	limit := c.DefaultQuery("limit", "20")
 
 	if source == "" || keyword == "" {
-		c.JSON(400, gin.H{"code": 400, "message": "缺少参数"})
+		c.JSON(400, models.Error(400, "缺少参数"))
+		return
+	}
+	if source == "all" {
+		searchAllSources(c, keyword)
 		return
 	}
 
-	params := url.Values{}
-	params.Set("source", source)
-	params.Set("type", "search")
-	params.Set("keyword", keyword)
-	params.Set("limit", limit)
-
-	reqURL := baseURL + "/api/?" + params.Encode()
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
 
-	resp, err := http.Get(reqURL)
+	songs, cache, err := searchSongs(source, keyword, limit)
+	setCacheHeader(c, cache)
 	if err != nil {
-		c.JSON(500, gin.H{"code": 500, "message": "请求失败"})
+		respondUpstreamError(c, err)
 		return
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	c.Data(resp.StatusCode, "application/json", body)
+	c.JSON(200, upstreamSuccess(models.SearchResult{
+		Keyword: keyword,
+		Source:  source,
+		Results: songs,
+	}, cache))
 }
 
 // GetMusicURL 获取音乐文件URL
@@ -186,39 +287,35 @@ func GetMusicURL(c *gin.Context) {
 		return
 	}
 
-	params := url.Values{}
-	params.Set("source", source)
-	params.Set("type", "url")
-	params.Set("id", id)
-	params.Set("br", br)
-
-	reqURL := baseURL + "/api/?" + params.Encode()
-
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
+	if err := allowSource(source); err != nil {
+		respondUpstreamError(c, err)
+		return
 	}
 
-	resp, err := client.Get(reqURL)
+	// 与下载相同，解析结果计入上游和音源状态
+	location, sourceSwitch, err := resolveMusicURL(source, id, br)
+	var upErr *upstreamError
+	if errors.As(err, &upErr) {
+		recordUpstreamResult(source, upErr.Status, nil)
+	} else {
+		recordUpstreamResult(source, http.StatusFound, err)
+	}
 	if err != nil {
-		c.JSON(500, gin.H{"code": 500, "message": "请求失败"})
+		respondUpstreamError(c, err)
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == 302 {
-		location := resp.Header.Get("Location")
-		sourceSwitch := resp.Header.Get("X-Source-Switch")
-		c.JSON(200, gin.H{
-			"code":         200,
-			"url":          location,
-			"sourceSwitch": sourceSwitch,
-		})
-	} else {
-		body, _ := io.ReadAll(resp.Body)
-		c.Data(resp.StatusCode, "application/json", body)
-	}
+	proxyParams := url.Values{}
+	proxyParams.Set("source", source)
+	proxyParams.Set("id", id)
+	proxyParams.Set("br", br)
+	cache := cacheResult{State: cacheBypass}
+	setCacheHeader(c, cache)
+	c.JSON(200, upstreamSuccess(models.MusicURL{
+		URL:          location,
+		ProxyURL:     "/api/v1/stream?" + proxyParams.Encode(),
+		SourceSwitch: sourceSwitch,
+	}, cache))
 }
 
 // DownloadMusic 下载音乐文件（异步）
@@ -228,6 +325,7 @@ func DownloadMusic(c *gin.Context) {
 	name := c.Query("name")
 	artist := c.Query("artist")
 	album := c.Query("album")
+	duration, _ := strconv.Atoi(c.Query("duration"))
 	br := c.DefaultQuery("br", "320k")
 
 	if source == "" || id == "" {
@@ -235,41 +333,8 @@ func DownloadMusic(c *gin.Context) {
 		return
 	}
 
-	taskID := source + "_" + id
-
-	// 检查是否已下载
-	libMutex.RLock()
-	for _, song := range downloadedSongs {
-		if song.ID == id && song.Source == source {
-			libMutex.RUnlock()
-			c.JSON(200, gin.H{"code": 200, "message": "已下载", "taskId": taskID})
-			return
-		}
-	}
-	libMutex.RUnlock()
-
-	// 创建下载任务
-	taskMutex.Lock()
-	if _, exists := downloadTasks[taskID]; exists {
-		taskMutex.Unlock()
-		c.JSON(200, gin.H{"code": 200, "message": "下载中", "taskId": taskID})
-		return
-	}
-	task := &DownloadTask{
-		ID:       taskID,
-		Name:     name,
-		Artist:   artist,
-		Source:   source,
-		Status:   "pending",
-		Progress: 0,
-	}
-	downloadTasks[taskID] = task
-	taskMutex.Unlock()
-
-	// 异步下载
-	go doDownload(task, source, id, name, artist, album, br)
-
-	c.JSON(200, gin.H{"code": 200, "message": "已加入下载队列", "taskId": taskID})
+	taskID, status := enqueueDownload(source, id, name, artist, album, duration, br)
+	c.JSON(200, gin.H{"code": 200, "message": status.message(), "taskId": taskID})
 }
 
 // sanitizeFilename 清理文件名中的非法字符
@@ -288,24 +353,6 @@ func doDownload(task *DownloadTask, source, id, name, artist, album, br string)
 	task.Progress = 0
 	taskMutex.Unlock()
 
-	params := url.Values{}
-	params.Set("source", source)
-	params.Set("type", "url")
-	params.Set("id", id)
-	params.Set("br", br)
-
-	reqURL := baseURL + "/api/?" + params.Encode()
-
-	resp, err := http.Get(reqURL)
-	if err != nil {
-		taskMutex.Lock()
-		task.Status = "failed"
-		task.Error = "请求失败"
-		taskMutex.Unlock()
-		return
-	}
-	defer resp.Body.Close()
-
 	os.MkdirAll(DownloadDir, 0755)
 
 	ext := ".mp3"
@@ -315,30 +362,20 @@ func doDownload(task *DownloadTask, source, id, name, artist, album, br string)
 	filename := sanitizeFilename(artist + " - " + name + ext)
 	filePath := filepath.Join(DownloadDir, filename)
 
-	file, err := os.Create(filePath)
+	match, err := fetchWithFallback(task, source, id, name, artist, album, br, filePath)
 	if err != nil {
-		taskMutex.Lock()
-		task.Status = "failed"
-		task.Error = "创建文件失败"
-		taskMutex.Unlock()
+		// 上游不可用时不算失败，等待恢复后重新下载
+		if (err.Type == errTypeNetwork || err.Type == errTypeUpstream) && !upstreamHealthy() {
+			addWaitingDownload(waitingDownload{task, source, id, name, artist, album, br})
+			return
+		}
+		task.fail(err)
 		return
 	}
-	defer file.Close()
 
-	// 使用进度追踪 writer
-	pw := &progressWriter{
-		task:  task,
-		total: resp.ContentLength,
-		file:  file,
-	}
-
-	_, err = io.Copy(pw, resp.Body)
-	if err != nil {
-		taskMutex.Lock()
-		task.Status = "failed"
-		task.Error = "写入失败"
-		taskMutex.Unlock()
-		return
+	var size int64
+	if info, err := os.Stat(filePath); err == nil {
+		size = info.Size()
 	}
 
 	taskMutex.Lock()
@@ -346,9 +383,8 @@ func doDownload(task *DownloadTask, source, id, name, artist, album, br string)
 	task.Progress = 100
 	taskMutex.Unlock()
 
-	// 添加到音乐库
-	libMutex.Lock()
-	downloadedSongs = append(downloadedSongs, DownloadedSong{
+	// 添加到音乐库，跨音源替换时仍按原歌曲记录，并注明实际来源
+	song := DownloadedSong{
 		ID:       id,
 		Name:     name,
 		Artist:   artist,
@@ -357,20 +393,216 @@ func doDownload(task *DownloadTask, source, id, name, artist, album, br string)
 		Filename: filename,
 		Path:     filePath,
 		Time:     time.Now().Format("2006-01-02 15:04"),
-	})
+		Quality:  br,
+		Size:     size,
+		Duration: task.duration,
+	}
+	if match != nil {
+		song.MatchSource = match.Source
+		song.MatchID = match.ID
+		song.MatchScore = match.Score
+		if song.Duration == 0 {
+			song.Duration = match.Duration
+		}
+	}
+	libMutex.Lock()
+	downloadedSongs = append(downloadedSongs, song)
 	// 持久化保存
 	syncLibraryToStorage()
 	libMutex.Unlock()
 }
 
+// downloadIdleTimeout 下载过程中超过该时间没有收到数据视为连接中断
+const downloadIdleTimeout = 30 * time.Second
+
+// downloadClient 从 CDN 下载文件使用的 HTTP 客户端
+// 文件大小不定，不限制总时长，只限制连接和等待响应头的时间，读取超时由 idleTimeoutReader 控制
+var downloadClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 10 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: upstreamTimeout,
+	},
+}
+
+// errDownloadStalled 下载过程中长时间没有收到数据
+var errDownloadStalled = errors.New("下载超时")
+
+// idleTimeoutReader 每次读到数据后重新计时，超时取消请求，使阻塞的 Read 返回
+type idleTimeoutReader struct {
+	r       io.Reader
+	timer   *time.Timer
+	stalled atomic.Bool
+}
+
+func newIdleTimeoutReader(r io.Reader, cancel context.CancelFunc) *idleTimeoutReader {
+	ir := &idleTimeoutReader{r: r}
+	ir.timer = time.AfterFunc(downloadIdleTimeout, func() {
+		ir.stalled.Store(true)
+		cancel()
+	})
+	return ir
+}
+
+func (ir *idleTimeoutReader) Read(p []byte) (int, error) {
+	n, err := ir.r.Read(p)
+	if ir.stalled.Load() {
+		return n, errDownloadStalled
+	}
+	if n > 0 {
+		ir.timer.Reset(downloadIdleTimeout)
+	}
+	return n, err
+}
+
+// stop 停止计时
+func (ir *idleTimeoutReader) stop() {
+	ir.timer.Stop()
+}
+
+// fetchToFile 下载歌曲到指定路径，先写入临时文件，完成后再原子替换
+// 网络错误、5xx 和 429 按 retryPolicies["url"] 重试，音源熔断中直接失败
+func fetchToFile(task *DownloadTask, source, id, br, filePath string) *downloadError {
+	if err := allowSource(source); err != nil {
+		return &downloadError{Type: errTypeUpstream, Message: err.Error()}
+	}
+
+	policy := retryPolicyFor("url")
+	ctx, cancel := policy.context()
+	defer cancel()
+	for attempt := 1; ; attempt++ {
+		derr := fetchToFileOnce(task, source, id, br, filePath)
+		if derr != nil && (derr.Type == errTypeNetwork || derr.Type == errTypeUpstream) {
+			if delay, ok := policy.retryDelay(ctx, attempt, derr.Status, derr.Header, derr.Err); ok {
+				log.Printf("下载 %s_%s 失败，%v 后重试 (%d/%d): %s",
+					source, id, delay.Round(time.Millisecond), attempt, policy.Attempts-1, attemptError(derr.Status, derr.Err))
+				taskMutex.Lock()
+				task.Retries++
+				task.Progress = 0
+				taskMutex.Unlock()
+				time.Sleep(delay)
+				continue
+			}
+		}
+
+		// 只有解析播放地址的失败计入上游状态，CDN 和本地磁盘的错误与 music-dl API 无关
+		if derr != nil && derr.Resolve {
+			recordUpstreamResult(source, derr.Status, derr.Err)
+		}
+		return derr
+	}
+}
+
+// fetchToFileOnce 解析一次播放地址并从 CDN 下载文件
+func fetchToFileOnce(task *DownloadTask, source, id, br, filePath string) *downloadError {
+	location, _, err := resolveMusicURL(source, id, br)
+	if err != nil {
+		var upErr *upstreamError
+		if errors.As(err, &upErr) {
+			return &downloadError{
+				Type:    errTypeUpstream,
+				Message: upErr.Message,
+				Status:  upErr.Status,
+				Header:  upErr.Header,
+				Resolve: true,
+			}
+		}
+		return &downloadError{Type: errTypeNetwork, Message: err.Error(), Err: err, Resolve: true}
+	}
+	recordUpstreamResult(source, http.StatusFound, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", location, nil)
+	if err != nil {
+		return &downloadError{Type: errTypeUpstream, Message: "播放地址无效"}
+	}
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		message := "请求失败"
+		if os.IsTimeout(err) {
+			message = "请求超时"
+		}
+		return &downloadError{Type: errTypeNetwork, Message: message, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return &downloadError{Type: errTypeUpstream, Message: "请求失败", Status: resp.StatusCode, Header: resp.Header}
+	}
+
+	// 开始前根据 Content-Length 检查空间
+	dir := filepath.Dir(filePath)
+	if resp.ContentLength > 0 {
+		if gerr := checkDiskSpace(dir, resp.ContentLength, 0); gerr != nil {
+			return gerr
+		}
+	} else if gerr := checkDiskSpace(dir, 0, 0); gerr != nil {
+		return gerr
+	}
+
+	tmpPath := filePath + ".part"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return &downloadError{Type: errTypeIO, Message: "创建文件失败"}
+	}
+
+	// 使用进度追踪 writer
+	pw := &progressWriter{
+		task:  task,
+		total: resp.ContentLength,
+		file:  file,
+		dir:   dir,
+	}
+
+	body := newIdleTimeoutReader(resp.Body, cancel)
+	n, err := io.Copy(pw, body)
+	body.stop()
+	file.Close()
+	if err == nil && resp.ContentLength > 0 && n != resp.ContentLength {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		switch {
+		case pw.guardErr != nil:
+			return pw.guardErr
+		case isNoSpace(err):
+			return &downloadError{Type: errTypeDiskFull, Message: "磁盘空间已满"}
+		case errors.Is(err, errDownloadStalled):
+			return &downloadError{Type: errTypeNetwork, Message: err.Error(), Err: err}
+		case pw.writeErr == nil:
+			// 读取上游中断
+			return &downloadError{Type: errTypeNetwork, Message: "下载中断", Err: err}
+		default:
+			return &downloadError{Type: errTypeIO, Message: "写入失败"}
+		}
+	}
+
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		os.Remove(tmpPath)
+		return &downloadError{Type: errTypeIO, Message: "保存文件失败"}
+	}
+	return nil
+}
+
 // GetSettings 获取设置
 func GetSettings(c *gin.Context) {
 	settings := storage.GetSettings()
 	c.JSON(200, gin.H{
 		"code": 200,
 		"data": gin.H{
-			"downloadDir": settings.DownloadDir,
-			"quality":     settings.Quality,
+			"downloadDir":    settings.DownloadDir,
+			"quality":        settings.Quality,
+			"minFreeSpace":   settings.MinFreeSpace,
+			"maxLibrarySize": settings.MaxLibrarySize,
+			"streamCache":    settings.StreamCache,
+			"autoM3U":        settings.AutoM3U,
+			"crossSource":    settings.CrossSource,
+			"subsonicUser":   settings.SubsonicUser,
+			// 密码不回传，只告知是否已设置
+			"subsonicEnabled": settings.SubsonicPassword != "",
 		},
 	})
 }
@@ -378,8 +610,15 @@ func GetSettings(c *gin.Context) {
 // UpdateSettings 更新设置
 func UpdateSettings(c *gin.Context) {
 	var req struct {
-		DownloadDir string `json:"downloadDir"`
-		Quality     string `json:"quality"`
+		DownloadDir      string  `json:"downloadDir"`
+		Quality          string  `json:"quality"`
+		MinFreeSpace     *int64  `json:"minFreeSpace"`
+		MaxLibrarySize   *int64  `json:"maxLibrarySize"`
+		StreamCache      *bool   `json:"streamCache"`
+		AutoM3U          *bool   `json:"autoM3U"`
+		CrossSource      *bool   `json:"crossSource"`
+		SubsonicUser     *string `json:"subsonicUser"`
+		SubsonicPassword *string `json:"subsonicPassword"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(400, gin.H{"code": 400, "message": "参数错误"})
@@ -390,15 +629,54 @@ func UpdateSettings(c *gin.Context) {
 		DownloadDir = req.DownloadDir
 	}
 
+	// 未传入的空间限制保持原值
+	current := storage.GetSettings()
+	if req.MinFreeSpace != nil {
+		current.MinFreeSpace = *req.MinFreeSpace
+	}
+	if req.MaxLibrarySize != nil {
+		current.MaxLibrarySize = *req.MaxLibrarySize
+	}
+	if req.StreamCache != nil {
+		current.StreamCache = *req.StreamCache
+	}
+	if req.AutoM3U != nil {
+		current.AutoM3U = *req.AutoM3U
+	}
+	if req.CrossSource != nil {
+		current.CrossSource = *req.CrossSource
+	}
+	if req.SubsonicUser != nil {
+		current.SubsonicUser = *req.SubsonicUser
+	}
+	if req.SubsonicPassword != nil {
+		current.SubsonicPassword = *req.SubsonicPassword
+	}
+	if current.MinFreeSpace < 0 || current.MaxLibrarySize < 0 {
+		c.JSON(400, gin.H{"code": 400, "message": "参数错误"})
+		return
+	}
+
 	// 持久化保存设置
 	err := storage.UpdateSettings(storage.Settings{
-		DownloadDir: DownloadDir,
-		Quality:     req.Quality,
+		DownloadDir:      DownloadDir,
+		Quality:          req.Quality,
+		MinFreeSpace:     current.MinFreeSpace,
+		MaxLibrarySize:   current.MaxLibrarySize,
+		StreamCache:      current.StreamCache,
+		AutoM3U:          current.AutoM3U,
+		CrossSource:      current.CrossSource,
+		SubsonicUser:     current.SubsonicUser,
+		SubsonicPassword: current.SubsonicPassword,
 	})
 	if err != nil {
 		c.JSON(500, gin.H{"code": 500, "message": "保存设置失败"})
 		return
 	}
+	setDiskGuard(current.MinFreeSpace, current.MaxLibrarySize)
+	streamCacheEnabled.Store(current.StreamCache)
+	autoM3UEnabled.Store(current.AutoM3U)
+	crossSourceEnabled.Store(current.CrossSource)
 
 	c.JSON(200, gin.H{
 		"code":    200,
@@ -474,24 +752,17 @@ func IsDownloaded(c *gin.Context) {
 func GetToplists(c *gin.Context) {
 	source := c.Query("source")
 	if source == "" {
-		c.JSON(400, gin.H{"code": 400, "message": "缺少参数"})
+		c.JSON(400, models.Error(400, "缺少参数"))
 		return
 	}
 
-	params := url.Values{}
-	params.Set("source", source)
-	params.Set("type", "toplists")
-
-	reqURL := baseURL + "/api/?" + params.Encode()
-	resp, err := http.Get(reqURL)
+	toplists, cache, err := fetchToplists(source)
+	setCacheHeader(c, cache)
 	if err != nil {
-		c.JSON(500, gin.H{"code": 500, "message": "请求失败"})
+		respondUpstreamError(c, err)
 		return
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	c.Data(resp.StatusCode, "application/json", body)
+	c.JSON(200, upstreamSuccess(models.ToplistList{Source: source, List: toplists}, cache))
 }
 
 // GetToplistSongs 获取排行榜歌曲
@@ -499,25 +770,26 @@ func GetToplistSongs(c *gin.Context) {
 	source := c.Query("source")
 	id := c.Query("id")
 	if source == "" || id == "" {
-		c.JSON(400, gin.H{"code": 400, "message": "缺少参数"})
+		c.JSON(400, models.Error(400, "缺少参数"))
 		return
 	}
 
-	params := url.Values{}
-	params.Set("source", source)
-	params.Set("type", "toplist")
-	params.Set("id", id)
-
-	reqURL := baseURL + "/api/?" + params.Encode()
-	resp, err := http.Get(reqURL)
+	songs, cache, err := fetchToplistSongs(source, id, false)
+	setCacheHeader(c, cache)
 	if err != nil {
-		c.JSON(500, gin.H{"code": 500, "message": "请求失败"})
+		respondUpstreamError(c, err)
 		return
 	}
-	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
-	c.Data(resp.StatusCode, "application/json", body)
+	// 每次从上游获取都记录快照，用于排名历史
+	if len(songs) > 0 && cache.State != cacheStale {
+		snapTime := time.Now().Format("2006-01-02 15:04:05")
+		if _, err := saveToplistSnapshot(source, id, snapTime, rankedSongs(songs)); err != nil {
+			log.Printf("保存排行榜快照失败 [%s/%s]: %v", source, id, err)
+		}
+	}
+
+	c.JSON(200, upstreamSuccess(models.ToplistDetail{ID: id, Source: source, List: songs}, cache))
 }
 
 // ImportPlaylist 导入歌单
@@ -530,78 +802,91 @@ func ImportPlaylist(c *gin.Context) {
 		return
 	}
 
+	respondImport(c, source, id)
+}
+
+// respondImport 导入歌单并输出结果
+func respondImport(c *gin.Context, source, id string) {
+	playlist, cache, err := importPlaylist(source, id)
+	setCacheHeader(c, cache)
+	if err != nil {
+		respondUpstreamError(c, err)
+		return
+	}
+
+	resp := upstreamSuccess(playlist, cache)
+	resp.Message = "导入成功"
+	c.JSON(200, resp)
+}
+
+// fetchPlaylist 从上游获取歌单信息并校验响应结构，歌曲保持上游顺序，fresh 为 true 时不使用缓存
+func fetchPlaylist(source, id string, fresh bool) (models.Playlist, cacheResult, error) {
 	params := url.Values{}
 	params.Set("source", source)
 	params.Set("type", "playlist")
 	params.Set("id", id)
 
-	reqURL := baseURL + "/api/?" + params.Encode()
-	resp, err := http.Get(reqURL)
-	if err != nil {
-		c.JSON(500, gin.H{"code": 500, "message": "请求失败"})
-		return
+	var data struct {
+		List *[]upstreamSong `json:"list"`
+		Info struct {
+			Name   string `json:"name"`
+			Author string `json:"author"`
+		} `json:"info"`
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-
-	// 解析响应
-	var result struct {
-		Code int `json:"code"`
-		Data struct {
-			List []struct {
-				ID     string   `json:"id"`
-				Name   string   `json:"name"`
-				Artist string   `json:"artist"`
-				Album  string   `json:"album"`
-				Types  []string `json:"types"`
-			} `json:"list"`
-			Info struct {
-				Name   string `json:"name"`
-				Author string `json:"author"`
-			} `json:"info"`
-		} `json:"data"`
-	}
-
-	if err := json.Unmarshal(body, &result); err != nil {
-		c.JSON(500, gin.H{"code": 500, "message": "解析响应失败"})
-		return
+	cache, err := fetchUpstream(upstreamClient, params, fresh, &data)
+	if err != nil {
+		return models.Playlist{}, cache, err
 	}
-
-	if result.Code != 200 {
-		c.Data(resp.StatusCode, "application/json", body)
-		return
+	if data.List == nil {
+		return models.Playlist{}, cache, missingField("playlist", source, "list")
 	}
 
-	// 保存歌单到本地
-	playlist := storage.Playlist{
+	return models.Playlist{
 		ID:     id,
 		Source: source,
-		Name:   result.Data.Info.Name,
-		Author: result.Data.Info.Author,
-		Songs:  make([]storage.PlaylistSong, len(result.Data.List)),
-	}
+		Name:   data.Info.Name,
+		Author: data.Info.Author,
+		Songs:  upstreamSongs("playlist", source, *data.List),
+	}, cache, nil
+}
 
-	for i, song := range result.Data.List {
+// storagePlaylist 将上游歌单转换为本地保存的结构
+func storagePlaylist(p models.Playlist) storage.Playlist {
+	playlist := storage.Playlist{
+		ID:     p.ID,
+		Source: p.Source,
+		Name:   p.Name,
+		Author: p.Author,
+		Songs:  make([]storage.PlaylistSong, len(p.Songs)),
+	}
+	for i, song := range p.Songs {
 		playlist.Songs[i] = storage.PlaylistSong{
-			ID:     song.ID,
-			Name:   song.Name,
-			Artist: song.Artist,
-			Album:  song.Album,
-			Types:  song.Types,
+			ID:       song.ID,
+			Source:   p.Source,
+			Name:     song.Name,
+			Artist:   song.Artist,
+			Album:    song.Album,
+			Types:    song.Types,
+			Duration: song.Duration,
 		}
 	}
+	return playlist
+}
+
+// importPlaylist 从上游获取歌单并保存到本地，返回缓存情况
+func importPlaylist(source, id string) (storage.Playlist, cacheResult, error) {
+	fetched, cache, err := fetchPlaylist(source, id, false)
+	if err != nil {
+		return storage.Playlist{}, cache, err
+	}
 
+	playlist := storagePlaylist(fetched)
 	if err := storage.AddPlaylist(playlist); err != nil {
-		c.JSON(500, gin.H{"code": 500, "message": "保存歌单失败"})
-		return
+		return playlist, cache, errors.New("保存歌单失败")
 	}
+	playlistChanged(source, id)
 
-	c.JSON(200, gin.H{
-		"code":    200,
-		"message": "导入成功",
-		"data":    playlist,
-	})
+	return playlist, cache, nil
 }
 
 // GetPlaylists 获取已导入的歌单列表
@@ -610,6 +895,38 @@ func GetPlaylists(c *gin.Context) {
 	c.JSON(200, gin.H{"code": 200, "data": playlists})
 }
 
+// GetPlaylist 获取歌单详情，id 以 .m3u8 结尾时导出为 M3U 播放列表，
+// 以 .zip 结尾时打包下载已下载的歌曲
+func GetPlaylist(c *gin.Context) {
+	source := c.Param("source")
+	id := c.Param("id")
+	if strings.HasSuffix(id, ".zip") {
+		exportPlaylistZip(c)
+		return
+	}
+	asM3U := strings.HasSuffix(id, ".m3u8")
+	id = strings.TrimSuffix(id, ".m3u8")
+
+	playlist, ok := storage.GetPlaylist(id, source)
+	if !ok {
+		c.JSON(404, gin.H{"code": 404, "message": "歌单不存在"})
+		return
+	}
+
+	if !asM3U {
+		c.JSON(200, gin.H{"code": 200, "data": playlist})
+		return
+	}
+
+	mode, ok := exportMode(c)
+	if !ok {
+		c.JSON(400, gin.H{"code": 400, "message": "参数错误"})
+		return
+	}
+	entries := newM3UExporter(c, mode).playlist(playlist)
+	writeM3U(c, m3uFilename(playlist), buildM3U(playlist.Name, entries))
+}
+
 // DeletePlaylist 删除歌单
 func DeletePlaylist(c *gin.Context) {
 	source := c.Query("source")
@@ -620,10 +937,14 @@ func DeletePlaylist(c *gin.Context) {
 		return
 	}
 
+	playlist, exists := storage.GetPlaylist(id, source)
 	if err := storage.DeletePlaylist(id, source); err != nil {
 		c.JSON(500, gin.H{"code": 500, "message": "删除失败"})
 		return
 	}
+	if exists {
+		playlistRemoved(playlist)
+	}
 
 	c.JSON(200, gin.H{"code": 200, "message": "删除成功"})
 }
@@ -0,0 +1,247 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"yinyue/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// idSeq 生成ID用的进程内序号
+var idSeq atomic.Uint64
+
+// newID 生成唯一ID：时间戳加递增序号（36 进制），同一时刻生成的ID也不会重复
+func newID() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatUint(idSeq.Add(1), 36)
+}
+
+// requireLocalPlaylist 只允许修改本地创建的歌单
+func requireLocalPlaylist(c *gin.Context) (id string, ok bool) {
+	if c.Param("source") != storage.LocalSource {
+		c.JSON(403, gin.H{"code": 403, "message": "只能修改本地歌单"})
+		return "", false
+	}
+	return c.Param("id"), true
+}
+
+// playlistError 输出歌单操作错误
+func playlistError(c *gin.Context, err error) {
+	if errors.Is(err, storage.ErrPlaylistNotFound) {
+		c.JSON(404, gin.H{"code": 404, "message": "歌单不存在"})
+		return
+	}
+	c.JSON(500, gin.H{"code": 500, "message": "保存歌单失败"})
+}
+
+// fillSongInfo 只传 source/id 时从音乐库补全歌曲信息
+func fillSongInfo(songs []storage.PlaylistSong) []storage.PlaylistSong {
+	result := make([]storage.PlaylistSong, 0, len(songs))
+	for _, s := range songs {
+		if s.ID == "" || s.Source == "" {
+			continue
+		}
+		if s.Name == "" {
+			if song, ok := findLibrarySong(s.Source, s.ID); ok {
+				s.Name = song.Name
+				s.Artist = song.Artist
+				s.Album = song.Album
+			}
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
+// CreateLocalPlaylist 创建本地歌单
+func CreateLocalPlaylist(c *gin.Context) {
+	var req struct {
+		Name        string                 `json:"name"`
+		Description string                 `json:"description"`
+		Cover       string                 `json:"cover"`
+		Songs       []storage.PlaylistSong `json:"songs"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" {
+		c.JSON(400, gin.H{"code": 400, "message": "参数错误"})
+		return
+	}
+
+	playlist := storage.Playlist{
+		ID:          newID(),
+		Source:      storage.LocalSource,
+		Name:        req.Name,
+		Author:      "本地",
+		Description: req.Description,
+		Cover:       req.Cover,
+		Songs:       fillSongInfo(req.Songs),
+	}
+
+	if err := storage.AddPlaylist(playlist); err != nil {
+		c.JSON(500, gin.H{"code": 500, "message": "保存歌单失败"})
+		return
+	}
+	playlistChanged(playlist.Source, playlist.ID)
+
+	playlist, _ = storage.GetPlaylist(playlist.ID, playlist.Source)
+	c.JSON(200, gin.H{"code": 200, "message": "创建成功", "data": playlist})
+}
+
+// UpdateLocalPlaylist 修改本地歌单名称、简介和封面
+func UpdateLocalPlaylist(c *gin.Context) {
+	id, ok := requireLocalPlaylist(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		Cover       *string `json:"cover"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 400, "message": "参数错误"})
+		return
+	}
+
+	playlist, exists := storage.GetPlaylist(id, storage.LocalSource)
+	if !exists {
+		c.JSON(404, gin.H{"code": 404, "message": "歌单不存在"})
+		return
+	}
+	if req.Name != nil {
+		if *req.Name == "" {
+			c.JSON(400, gin.H{"code": 400, "message": "歌单名称不能为空"})
+			return
+		}
+		playlist.Name = *req.Name
+	}
+	if req.Description != nil {
+		playlist.Description = *req.Description
+	}
+	if req.Cover != nil {
+		playlist.Cover = *req.Cover
+	}
+
+	err := storage.UpdatePlaylistInfo(id, storage.LocalSource, playlist.Name, playlist.Description, playlist.Cover)
+	if err != nil {
+		playlistError(c, err)
+		return
+	}
+	playlistChanged(storage.LocalSource, id)
+
+	c.JSON(200, gin.H{"code": 200, "message": "保存成功", "data": playlist})
+}
+
+// AddLocalPlaylistSongs 向本地歌单添加歌曲（可混合不同来源及音乐库中的歌曲）
+func AddLocalPlaylistSongs(c *gin.Context) {
+	id, ok := requireLocalPlaylist(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Songs []storage.PlaylistSong `json:"songs"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Songs) == 0 {
+		c.JSON(400, gin.H{"code": 400, "message": "参数错误"})
+		return
+	}
+
+	added, err := storage.AddPlaylistSongs(id, storage.LocalSource, fillSongInfo(req.Songs))
+	if err != nil {
+		playlistError(c, err)
+		return
+	}
+	playlistChanged(storage.LocalSource, id)
+
+	c.JSON(200, gin.H{"code": 200, "message": "添加成功", "added": added})
+}
+
+// RemoveLocalPlaylistSongs 从本地歌单移除歌曲
+func RemoveLocalPlaylistSongs(c *gin.Context) {
+	id, ok := requireLocalPlaylist(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Songs []storage.SongRef `json:"songs"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Songs) == 0 {
+		c.JSON(400, gin.H{"code": 400, "message": "参数错误"})
+		return
+	}
+
+	removed, err := storage.RemovePlaylistSongs(id, storage.LocalSource, req.Songs)
+	if err != nil {
+		playlistError(c, err)
+		return
+	}
+	playlistChanged(storage.LocalSource, id)
+
+	c.JSON(200, gin.H{"code": 200, "message": "移除成功", "removed": removed})
+}
+
+// ReorderPlaylistSongs 调整歌单歌曲顺序，可传完整顺序 songs，或用 song + position 移动单首歌曲
+// 导入的歌单同样可以排序，重新导入时会恢复为上游顺序
+func ReorderPlaylistSongs(c *gin.Context) {
+	source := c.Param("source")
+	id := c.Param("id")
+
+	var req struct {
+		Songs    []storage.SongRef `json:"songs"`
+		Song     *storage.SongRef  `json:"song"`
+		Position int               `json:"position"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || (len(req.Songs) == 0 && req.Song == nil) {
+		c.JSON(400, gin.H{"code": 400, "message": "参数错误"})
+		return
+	}
+
+	order := req.Songs
+	if req.Song != nil {
+		playlist, ok := storage.GetPlaylist(id, source)
+		if !ok {
+			playlistError(c, storage.ErrPlaylistNotFound)
+			return
+		}
+		order = moveSong(playlist.Songs, *req.Song, req.Position)
+	}
+
+	if err := storage.ReorderPlaylistSongs(id, source, order); err != nil {
+		playlistError(c, err)
+		return
+	}
+	playlistChanged(source, id)
+
+	playlist, _ := storage.GetPlaylist(id, source)
+	c.JSON(200, gin.H{"code": 200, "message": "排序已保存", "data": playlist})
+}
+
+// moveSong 把歌曲移动到指定位置，返回新的顺序
+func moveSong(songs []storage.PlaylistSong, song storage.SongRef, position int) []storage.SongRef {
+	order := make([]storage.SongRef, 0, len(songs))
+	for _, s := range songs {
+		ref := storage.SongRef{ID: s.ID, Source: s.Source}
+		if ref != song {
+			order = append(order, ref)
+		}
+	}
+	if len(order) == len(songs) {
+		return order // 歌曲不在歌单中，保持原顺序
+	}
+
+	if position < 0 {
+		position = 0
+	}
+	if position > len(order) {
+		position = len(order)
+	}
+	order = append(order, storage.SongRef{})
+	copy(order[position+1:], order[position:])
+	order[position] = song
+	return order
+}
@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestNewIDUnique(t *testing.T) {
+	const n = 1000
+	ids := make(chan string, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ids <- newID()
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[string]bool, n)
+	for id := range ids {
+		if seen[id] {
+			t.Fatalf("newID() 重复: %s", id)
+		}
+		seen[id] = true
+	}
+}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"errors"
+	"os"
+
+	"yinyue/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 歌单歌曲的下载状态
+const (
+	songStateDownloaded  = "downloaded"
+	songStateQueued      = "queued"
+	songStateDownloading = "downloading"
+	songStateFailed      = "failed"
+	songStateMissingFile = "missing_file"
+	songStateNone        = "not_downloaded"
+)
+
+// PlaylistSongStatus 歌单中单首歌曲的下载状态
+type PlaylistSongStatus struct {
+	storage.PlaylistSongLibrary
+	State    string `json:"state"`
+	Progress int    `json:"progress,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// PlaylistStatus 歌单下载完成情况
+type PlaylistStatus struct {
+	Total    int                  `json:"total"`
+	Counts   map[string]int       `json:"counts"`
+	Bytes    int64                `json:"bytes"`
+	Complete float64              `json:"complete"` // 已下载比例 (0~1)
+	Songs    []PlaylistSongStatus `json:"songs"`
+}
+
+// songState 根据音乐库记录和下载任务判断歌曲状态
+func songState(song storage.PlaylistSongLibrary) PlaylistSongStatus {
+	status := PlaylistSongStatus{PlaylistSongLibrary: song, State: songStateNone}
+
+	if song.InLibrary {
+		if _, err := os.Stat(song.Path); err == nil {
+			status.State = songStateDownloaded
+			return status
+		}
+		status.State = songStateMissingFile
+	}
+
+	taskMutex.RLock()
+	defer taskMutex.RUnlock()
+
+	task, ok := downloadTasks[song.Source+"_"+song.ID]
+	if !ok {
+		return status
+	}
+	switch task.Status {
+	case "pending", "waiting":
+		status.State = songStateQueued
+	case "downloading":
+		status.State = songStateDownloading
+		status.Progress = task.Progress
+	case "failed":
+		// 文件丢失的歌曲保留 missing_file，便于区分
+		if status.State == songStateNone {
+			status.State = songStateFailed
+		}
+		status.Error = task.Error
+	}
+	return status
+}
+
+// GetPlaylistStatus 获取歌单中每首歌的下载状态和汇总
+func GetPlaylistStatus(c *gin.Context) {
+	songs, err := storage.GetPlaylistSongsWithLibrary(c.Param("id"), c.Param("source"))
+	if err != nil {
+		if errors.Is(err, storage.ErrPlaylistNotFound) {
+			c.JSON(404, gin.H{"code": 404, "message": "歌单不存在"})
+			return
+		}
+		c.JSON(500, gin.H{"code": 500, "message": "查询失败"})
+		return
+	}
+
+	result := PlaylistStatus{
+		Total: len(songs),
+		Counts: map[string]int{
+			songStateDownloaded:  0,
+			songStateQueued:      0,
+			songStateDownloading: 0,
+			songStateFailed:      0,
+			songStateMissingFile: 0,
+			songStateNone:        0,
+		},
+		Songs: make([]PlaylistSongStatus, len(songs)),
+	}
+	for i, song := range songs {
+		status := songState(song)
+		result.Songs[i] = status
+		result.Counts[status.State]++
+		if status.State == songStateDownloaded {
+			result.Bytes += song.Size
+		}
+	}
+	if result.Total > 0 {
+		result.Complete = float64(result.Counts[songStateDownloaded]) / float64(result.Total)
+	}
+
+	c.JSON(200, gin.H{"code": 200, "data": result})
+}
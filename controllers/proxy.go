@@ -0,0 +1,242 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// resolvedURLTTL 解析得到的播放地址在本地缓存的时长（CDN 签名地址会过期）
+const resolvedURLTTL = 10 * time.Minute
+
+// maxStreamCacheSize 代理播放缓存的容量上限，超出时删除最久未播放的文件
+const maxStreamCacheSize = 1 << 30
+
+type resolvedURL struct {
+	url     string
+	expires time.Time
+}
+
+var (
+	resolvedURLs  = make(map[string]resolvedURL)
+	resolvedMutex sync.Mutex
+
+	streamCacheMutex sync.Mutex
+
+	// streamCacheEnabled 是否缓存代理播放过的音频
+	streamCacheEnabled atomic.Bool
+)
+
+// relayHeaders 需要从上游转发给客户端的响应头
+var relayHeaders = []string{
+	"Content-Type", "Content-Length", "Content-Range",
+	"Accept-Ranges", "ETag", "Last-Modified",
+}
+
+// getStreamURL 获取播放地址，优先使用未过期的缓存；refresh 为 true 时强制重新解析
+func getStreamURL(source, id, br string, refresh bool) (string, error) {
+	key := source + "|" + id + "|" + br
+
+	resolvedMutex.Lock()
+	cached, ok := resolvedURLs[key]
+	if ok && !time.Now().Before(cached.expires) {
+		delete(resolvedURLs, key)
+		ok = false
+	}
+	resolvedMutex.Unlock()
+	if ok && !refresh {
+		return cached.url, nil
+	}
+
+	location, _, err := resolveMusicURL(source, id, br)
+	if err != nil {
+		return "", err
+	}
+
+	resolvedMutex.Lock()
+	resolvedURLs[key] = resolvedURL{url: location, expires: time.Now().Add(resolvedURLTTL)}
+	resolvedMutex.Unlock()
+	return location, nil
+}
+
+// pruneResolvedURLs 删除已过期的播放地址
+func pruneResolvedURLs(now time.Time) {
+	resolvedMutex.Lock()
+	defer resolvedMutex.Unlock()
+
+	for key, r := range resolvedURLs {
+		if !now.Before(r.expires) {
+			delete(resolvedURLs, key)
+		}
+	}
+}
+
+// streamCachePath 代理缓存文件路径
+func streamCachePath(source, id, br string) string {
+	ext := ".mp3"
+	if br == "flac" || br == "flac24bit" {
+		ext = ".flac"
+	}
+	return filepath.Join(dataDir, "cache", "stream", sanitizeFilename(source+"_"+id+"_"+br+ext))
+}
+
+// ProxyStream 服务端解析并转发上游音频流
+func ProxyStream(c *gin.Context) {
+	source := c.Query("source")
+	id := c.Query("id")
+	br := c.DefaultQuery("br", "320k")
+
+	if source == "" || id == "" {
+		c.JSON(400, gin.H{"code": 400, "message": "缺少参数"})
+		return
+	}
+
+	// 已缓存的直接从本地播放
+	cachePath := streamCachePath(source, id, br)
+	if _, err := os.Stat(cachePath); err == nil {
+		// 修改时间记录最近播放时间，用于淘汰
+		now := time.Now()
+		os.Chtimes(cachePath, now, now)
+		serveAudioFile(c, cachePath)
+		return
+	}
+
+	resp, err := openUpstreamStream(c.Request, source, id, br)
+	if err != nil {
+		c.JSON(502, gin.H{"code": 502, "message": err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, h := range relayHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			c.Header(h, v)
+		}
+	}
+	c.Status(resp.StatusCode)
+
+	// 仅在完整请求时写入缓存
+	if streamCacheEnabled.Load() && resp.StatusCode == 200 && resp.ContentLength > 0 &&
+		hasCacheSpace(resp.ContentLength) && reserveStreamCache(resp.ContentLength) {
+		relayAndCache(c, resp, cachePath)
+		return
+	}
+
+	io.Copy(c.Writer, resp.Body)
+}
+
+// openUpstreamStream 请求上游音频，签名地址失效时自动重新解析一次
+func openUpstreamStream(r *http.Request, source, id, br string) (*http.Response, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		streamURL, err := getStreamURL(source, id, br, attempt > 0)
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(r.Context(), "GET", streamURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		// 只转发 Range 相关请求头，不透传客户端 IP
+		for _, h := range []string{"Range", "If-Range"} {
+			if v := r.Header.Get(h); v != "" {
+				req.Header.Set(h, v)
+			}
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		switch resp.StatusCode {
+		case http.StatusForbidden, http.StatusNotFound, http.StatusGone:
+			// 签名过期，重新解析地址
+			resp.Body.Close()
+			continue
+		}
+		return resp, nil
+	}
+	return nil, errUpstreamStream
+}
+
+var errUpstreamStream = errors.New("播放地址已失效")
+
+// hasCacheSpace 缓存同样遵守最小剩余空间设置
+func hasCacheSpace(need int64) bool {
+	free, err := diskFree(dataDir)
+	return err == nil && free-need >= minFreeSpace.Load()
+}
+
+// reserveStreamCache 为新缓存腾出空间，按最近播放时间从旧到新删除缓存文件
+// 单个文件超过容量上限时不缓存
+func reserveStreamCache(need int64) bool {
+	if need > maxStreamCacheSize {
+		return false
+	}
+
+	streamCacheMutex.Lock()
+	defer streamCacheMutex.Unlock()
+
+	dir := filepath.Join(dataDir, "cache", "stream")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return os.IsNotExist(err)
+	}
+
+	var files []os.FileInfo
+	var total int64
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || info.IsDir() || strings.HasSuffix(e.Name(), ".part") {
+			continue
+		}
+		files = append(files, info)
+		total += info.Size()
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+	for _, f := range files {
+		if total+need <= maxStreamCacheSize {
+			break
+		}
+		if err := os.Remove(filepath.Join(dir, f.Name())); err == nil {
+			total -= f.Size()
+		}
+	}
+	return total+need <= maxStreamCacheSize
+}
+
+// relayAndCache 转发音频的同时写入缓存，完整写入后才重命名为缓存文件
+func relayAndCache(c *gin.Context, resp *http.Response, cachePath string) {
+	os.MkdirAll(filepath.Dir(cachePath), 0755)
+
+	tmpPath := cachePath + ".part"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		io.Copy(c.Writer, resp.Body)
+		return
+	}
+
+	n, err := io.Copy(io.MultiWriter(c.Writer, file), resp.Body)
+	file.Close()
+	if err != nil || n != resp.ContentLength {
+		os.Remove(tmpPath)
+		return
+	}
+
+	if err := os.Rename(tmpPath, cachePath); err != nil {
+		log.Printf("保存播放缓存失败: %v", err)
+		os.Remove(tmpPath)
+	}
+}
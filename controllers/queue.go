@@ -0,0 +1,134 @@
+package controllers
+
+import "sync"
+
+// maxConcurrentDownloads 同时进行的下载任务数，其余任务保持 pending 排队
+const maxConcurrentDownloads = 3
+
+// downloadSlots 下载并发控制
+var downloadSlots = make(chan struct{}, maxConcurrentDownloads)
+
+// waitingDownload 上游不可用时等待恢复的下载
+type waitingDownload struct {
+	task                                *DownloadTask
+	source, id, name, artist, album, br string
+}
+
+var (
+	waitingDownloads []waitingDownload
+	waitingMutex     sync.Mutex
+)
+
+// enqueueStatus 加入下载队列的结果
+type enqueueStatus int
+
+const (
+	enqueueQueued     enqueueStatus = iota // 新建任务并加入队列
+	enqueueWaiting                         // 新建任务，等待上游恢复后下载
+	enqueueRunning                         // 已有未结束的任务
+	enqueueDownloaded                      // 已在音乐库中
+)
+
+// created 是否新建了下载任务
+func (s enqueueStatus) created() bool {
+	return s == enqueueQueued || s == enqueueWaiting
+}
+
+// message 返回给用户的提示信息
+func (s enqueueStatus) message() string {
+	switch s {
+	case enqueueWaiting:
+		return "上游服务不可用，恢复后自动下载"
+	case enqueueRunning:
+		return "下载中"
+	case enqueueDownloaded:
+		return "已下载"
+	}
+	return "已加入下载队列"
+}
+
+// enqueueDownload 创建下载任务并加入队列，已下载或正在下载时不会重复创建
+// duration 为歌曲时长（秒），未知时传 0；返回任务ID以及加入队列的结果
+func enqueueDownload(source, id, name, artist, album string, duration int, br string) (taskID string, status enqueueStatus) {
+	taskID = source + "_" + id
+
+	// 检查是否已下载
+	libMutex.RLock()
+	for _, song := range downloadedSongs {
+		if song.ID == id && song.Source == source {
+			libMutex.RUnlock()
+			return taskID, enqueueDownloaded
+		}
+	}
+	libMutex.RUnlock()
+
+	// 创建下载任务，失败的任务允许重新下载
+	taskMutex.Lock()
+	if existing, exists := downloadTasks[taskID]; exists && existing.Status != "failed" {
+		taskMutex.Unlock()
+		return taskID, enqueueRunning
+	}
+	task := &DownloadTask{
+		ID:       taskID,
+		Name:     name,
+		Artist:   artist,
+		Source:   source,
+		Status:   "pending",
+		Progress: 0,
+		duration: duration,
+	}
+	offline := !upstreamHealthy()
+	if offline {
+		task.Status = "waiting"
+	}
+	downloadTasks[taskID] = task
+	taskMutex.Unlock()
+
+	if offline {
+		addWaitingDownload(waitingDownload{task, source, id, name, artist, album, br})
+		return taskID, enqueueWaiting
+	}
+	startDownload(task, source, id, name, artist, album, br)
+	return taskID, enqueueQueued
+}
+
+// startDownload 异步下载，超出并发数时等待空闲
+func startDownload(task *DownloadTask, source, id, name, artist, album, br string) {
+	go func() {
+		downloadSlots <- struct{}{}
+		defer func() { <-downloadSlots }()
+		doDownload(task, source, id, name, artist, album, br)
+	}()
+}
+
+// addWaitingDownload 将任务标记为等待上游恢复
+func addWaitingDownload(w waitingDownload) {
+	taskMutex.Lock()
+	w.task.Status = "waiting"
+	w.task.Progress = 0
+	taskMutex.Unlock()
+
+	waitingMutex.Lock()
+	waitingDownloads = append(waitingDownloads, w)
+	waitingMutex.Unlock()
+
+	// 加入期间上游可能已经恢复
+	if upstreamHealthy() {
+		resumeWaitingDownloads()
+	}
+}
+
+// resumeWaitingDownloads 上游恢复后重新开始等待中的下载
+func resumeWaitingDownloads() {
+	waitingMutex.Lock()
+	waiting := waitingDownloads
+	waitingDownloads = nil
+	waitingMutex.Unlock()
+
+	for _, w := range waiting {
+		taskMutex.Lock()
+		w.task.Status = "pending"
+		taskMutex.Unlock()
+		startDownload(w.task, w.source, w.id, w.name, w.artist, w.album, w.br)
+	}
+}
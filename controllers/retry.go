@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// maxRetryAfter 上游要求等待超过该时间时不再重试
+const maxRetryAfter = 30 * time.Second
+
+// retryPolicy 重试策略，等待时间按指数增长并加入随机抖动
+type retryPolicy struct {
+	Attempts  int           // 最多请求次数（含首次）
+	BaseDelay time.Duration // 第一次重试前的等待时间，之后每次翻倍
+	MaxDelay  time.Duration
+	Budget    time.Duration // 包括重试在内的总时长上限，0 表示不限制
+}
+
+// retryPolicies 各类上游请求的重试策略，搜索需要尽快返回，重试次数较少且总时长不超过单个音源的搜索超时
+var retryPolicies = map[string]retryPolicy{
+	"search":   {Attempts: 2, BaseDelay: 300 * time.Millisecond, MaxDelay: time.Second, Budget: searchTimeout},
+	"toplists": {Attempts: 3, BaseDelay: 500 * time.Millisecond, MaxDelay: 5 * time.Second, Budget: 30 * time.Second},
+	"toplist":  {Attempts: 3, BaseDelay: 500 * time.Millisecond, MaxDelay: 5 * time.Second, Budget: 30 * time.Second},
+	"playlist": {Attempts: 3, BaseDelay: 500 * time.Millisecond, MaxDelay: 5 * time.Second, Budget: 30 * time.Second},
+	"pic":      {Attempts: 2, BaseDelay: 500 * time.Millisecond, MaxDelay: time.Second, Budget: 30 * time.Second},
+	"url":      {Attempts: 4, BaseDelay: time.Second, MaxDelay: 10 * time.Second},
+}
+
+// retryPolicyFor 获取请求类型的重试策略，未配置的类型不重试
+func retryPolicyFor(kind string) retryPolicy {
+	if p, ok := retryPolicies[kind]; ok {
+		return p
+	}
+	return retryPolicy{Attempts: 1}
+}
+
+// backoff 第 attempt 次请求失败后的等待时间，在 [d/2, d] 之间随机，避免多个请求同时重试
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay << (attempt - 1)
+	if d > p.MaxDelay || d <= 0 {
+		d = p.MaxDelay
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// context 按 Budget 限制总时长
+func (p retryPolicy) context() (context.Context, context.CancelFunc) {
+	if p.Budget > 0 {
+		return context.WithTimeout(context.Background(), p.Budget)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// retryDelay 判断第 attempt 次请求的结果是否可以重试，返回重试前的等待时间
+// 网络错误、超时、5xx 和 429 可以重试，429 优先使用 Retry-After；其他错误重试也不会成功
+// ctx 剩余的时间不够等待时不再重试
+func (p retryPolicy) retryDelay(ctx context.Context, attempt, status int, header http.Header, err error) (time.Duration, bool) {
+	if attempt >= p.Attempts || ctx.Err() != nil || !upstreamHealthy() {
+		return 0, false
+	}
+
+	var delay time.Duration
+	switch {
+	case err != nil, status >= 500:
+		delay = p.backoff(attempt)
+	case status == http.StatusTooManyRequests:
+		delay = p.backoff(attempt)
+		if after, ok := retryAfter(header); ok {
+			if after > maxRetryAfter {
+				return 0, false
+			}
+			delay = max(after, delay)
+		}
+	default:
+		return 0, false
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+		return 0, false
+	}
+	return delay, true
+}
+
+// retryAfter 解析 Retry-After 响应头（秒数或 HTTP 日期）
+func retryAfter(header http.Header) (time.Duration, bool) {
+	v := header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if sec, err := strconv.Atoi(v); err == nil && sec >= 0 {
+		return time.Duration(sec) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// recordUpstreamResult 记录一次上游请求（重试结束后）的结果，更新音源熔断器和上游健康状态
+// 网络错误、超时和 5xx 视为失败，其他状态码说明上游可以正常响应
+// 超时和 5xx 可能只是单个音源的问题，由熔断器处理；只有连不上 API 或所有音源都已熔断时才计入上游健康状态
+func recordUpstreamResult(source string, status int, err error) {
+	if err == nil && status < 500 {
+		recordUpstreamSuccess()
+		recordSourceSuccess(source)
+		return
+	}
+	reason := attemptError(status, err)
+	recordSourceFailure(source, reason)
+	switch {
+	case upstreamUnreachable(err):
+		recordUpstreamFailure(reason)
+	case allSourcesOpen():
+		markUpstreamOffline(reason)
+	}
+}
+
+// upstreamUnreachable 是否无法连接上游 API（超时可能只是某个音源响应慢，不算）
+func upstreamUnreachable(err error) bool {
+	return err != nil && !os.IsTimeout(err) && !errors.Is(err, errUpstreamTimeout)
+}
+
+// attemptError 请求失败的原因，用于日志和状态展示
+func attemptError(status int, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return strconv.Itoa(status) + " " + http.StatusText(status)
+}
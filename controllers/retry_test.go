@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"未设置", "", 0, false},
+		{"秒数", "3", 3 * time.Second, true},
+		{"零", "0", 0, true},
+		{"负数", "-1", 0, false},
+		{"无法解析", "soon", 0, false},
+		{"过去的日期", "Mon, 02 Jan 2006 15:04:05 GMT", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.value != "" {
+				header.Set("Retry-After", tt.value)
+			}
+			got, ok := retryAfter(header)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("retryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	header := http.Header{}
+	header.Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	if got, ok := retryAfter(header); !ok || got <= 50*time.Second || got > time.Minute {
+		t.Errorf("retryAfter(一分钟后) = %v, %v", got, ok)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := retryPolicy{Attempts: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	retryIn := func(s string) http.Header {
+		h := http.Header{}
+		h.Set("Retry-After", s)
+		return h
+	}
+
+	tests := []struct {
+		name    string
+		attempt int
+		status  int
+		header  http.Header
+		err     error
+		wantOK  bool
+		minWait time.Duration
+	}{
+		{name: "网络错误", attempt: 1, err: errors.New("connection reset"), wantOK: true},
+		{name: "5xx", attempt: 1, status: 503, wantOK: true},
+		{name: "429 没有 Retry-After", attempt: 1, status: 429, wantOK: true},
+		{name: "429 按 Retry-After 等待", attempt: 1, status: 429, header: retryIn("2"), wantOK: true, minWait: 2 * time.Second},
+		{name: "429 等待时间过长", attempt: 1, status: 429, header: retryIn("120"), wantOK: false},
+		{name: "4xx 不重试", attempt: 1, status: 404, wantOK: false},
+		{name: "成功不重试", attempt: 1, status: 200, wantOK: false},
+		{name: "已达到最多次数", attempt: 3, status: 503, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, ok := policy.retryDelay(context.Background(), tt.attempt, tt.status, tt.header, tt.err)
+			if ok != tt.wantOK {
+				t.Fatalf("retryDelay ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && delay < tt.minWait {
+				t.Errorf("retryDelay = %v, want ≥ %v", delay, tt.minWait)
+			}
+		})
+	}
+}
+
+func TestRetryDelayBudget(t *testing.T) {
+	policy := retryPolicy{Attempts: 3, BaseDelay: time.Second, MaxDelay: time.Second, Budget: 500 * time.Millisecond}
+	ctx, cancel := policy.context()
+	defer cancel()
+	if _, ok := policy.retryDelay(ctx, 1, 503, nil, nil); ok {
+		t.Error("剩余时间不够等待时不应重试")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := retryPolicy{Attempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{1, 50 * time.Millisecond, 100 * time.Millisecond},
+		{2, 100 * time.Millisecond, 200 * time.Millisecond},
+		{3, 200 * time.Millisecond, 400 * time.Millisecond},
+		{5, 500 * time.Millisecond, time.Second},
+		{60, 500 * time.Millisecond, time.Second},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if d := policy.backoff(tt.attempt); d < tt.min || d > tt.max {
+				t.Errorf("backoff(%d) = %v, want [%v, %v]", tt.attempt, d, tt.min, tt.max)
+			}
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"log"
+	"time"
+
+	"yinyue/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// schedulerTick 定时任务检查间隔
+const schedulerTick = time.Minute
+
+// minSubscriptionInterval 订阅同步的最小间隔（分钟）
+const minSubscriptionInterval = 10
+
+// defaultSubscriptionInterval 订阅同步的默认间隔（分钟）
+const defaultSubscriptionInterval = 24 * 60
+
+// StartScheduler 启动定时任务（启动时调用）
+func StartScheduler() {
+	startHealthMonitor()
+
+	go func() {
+		ticker := time.NewTicker(schedulerTick)
+		defer ticker.Stop()
+
+		for {
+			now := time.Now()
+			runDueSubscriptions(now)
+			pruneCache(now)
+			pruneResolvedURLs(now)
+			<-ticker.C
+		}
+	}()
+}
+
+// runDueSubscriptions 同步所有到期的歌单和排行榜订阅
+func runDueSubscriptions(now time.Time) {
+	for _, sub := range storage.GetSubscriptions() {
+		if !sub.Enabled || !subscriptionDue(sub.LastSync, sub.Interval, now) {
+			continue
+		}
+
+		var downloadBr string
+		if sub.AutoDownload {
+			downloadBr = preferredQuality(sub.Quality)
+		}
+
+		record, err := syncPlaylist(sub.PlaylistSource, sub.PlaylistID, "schedule", downloadBr)
+		if err != nil {
+			log.Printf("定时同步歌单失败 [%s/%s]: %v", sub.PlaylistSource, sub.PlaylistID, err)
+		} else {
+			log.Printf("定时同步歌单 [%s/%s]: 新增 %d，移除 %d，移动 %d，加入下载 %d",
+				sub.PlaylistSource, sub.PlaylistID, record.Added, record.Removed, record.Moved, record.Queued)
+		}
+
+		// 失败时同样记录同步时间，等下一个周期再重试
+		storage.SetSubscriptionSynced(sub.PlaylistID, sub.PlaylistSource, record.Time)
+	}
+
+	for _, sub := range storage.GetToplistSubscriptions() {
+		if !sub.Enabled || !subscriptionDue(sub.LastSync, sub.Interval, now) {
+			continue
+		}
+
+		result, err := syncToplist(sub)
+		if err != nil {
+			log.Printf("定时同步排行榜失败 [%s/%s]: %v", sub.Source, sub.ToplistID, err)
+		} else {
+			log.Printf("定时同步排行榜 [%s/%s]: 前 %d 首中加入下载 %d",
+				sub.Source, sub.ToplistID, sub.KeepTop, result.Queued)
+		}
+	}
+}
+
+// subscriptionDue 判断订阅是否到了同步时间
+func subscriptionDue(lastSync string, interval int, now time.Time) bool {
+	if lastSync == "" {
+		return true
+	}
+	last, err := time.ParseInLocation("2006-01-02 15:04:05", lastSync, time.Local)
+	if err != nil {
+		return true
+	}
+	return !now.Before(last.Add(time.Duration(interval) * time.Minute))
+}
+
+// preferredQuality 订阅的下载音质，未设置时使用全局设置
+func preferredQuality(quality string) string {
+	if quality != "" {
+		return quality
+	}
+	if q := storage.GetSettings().Quality; q != "" {
+		return q
+	}
+	return "320k"
+}
+
+// GetSubscriptions 获取歌单订阅列表
+func GetSubscriptions(c *gin.Context) {
+	c.JSON(200, gin.H{"code": 200, "data": storage.GetSubscriptions()})
+}
+
+// SetSubscription 订阅歌单或修改订阅设置
+func SetSubscription(c *gin.Context) {
+	source := c.Param("source")
+	id := c.Param("id")
+	if source == storage.LocalSource {
+		c.JSON(400, gin.H{"code": 400, "message": "本地歌单无法订阅"})
+		return
+	}
+
+	var req struct {
+		Interval     *int    `json:"interval"`
+		Quality      *string `json:"quality"`
+		AutoDownload *bool   `json:"autoDownload"`
+		Enabled      *bool   `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 400, "message": "参数错误"})
+		return
+	}
+
+	sub, ok := storage.GetSubscription(id, source)
+	if !ok {
+		sub = storage.Subscription{
+			PlaylistID:     id,
+			PlaylistSource: source,
+			Interval:       defaultSubscriptionInterval,
+			AutoDownload:   true,
+			Enabled:        true,
+		}
+	}
+	if req.Interval != nil {
+		sub.Interval = *req.Interval
+	}
+	if req.Quality != nil {
+		sub.Quality = *req.Quality
+	}
+	if req.AutoDownload != nil {
+		sub.AutoDownload = *req.AutoDownload
+	}
+	if req.Enabled != nil {
+		sub.Enabled = *req.Enabled
+	}
+
+	if sub.Interval < minSubscriptionInterval {
+		c.JSON(400, gin.H{"code": 400, "message": "同步间隔不能小于10分钟"})
+		return
+	}
+	if _, ok := qualityRank[sub.Quality]; sub.Quality != "" && !ok {
+		c.JSON(400, gin.H{"code": 400, "message": "音质参数错误"})
+		return
+	}
+
+	if err := storage.SetSubscription(sub); err != nil {
+		playlistError(c, err)
+		return
+	}
+
+	sub, _ = storage.GetSubscription(id, source)
+	c.JSON(200, gin.H{"code": 200, "message": "订阅已保存", "data": sub})
+}
+
+// DeleteSubscription 取消歌单订阅
+func DeleteSubscription(c *gin.Context) {
+	if err := storage.DeleteSubscription(c.Param("id"), c.Param("source")); err != nil {
+		c.JSON(500, gin.H{"code": 500, "message": "取消订阅失败"})
+		return
+	}
+	c.JSON(200, gin.H{"code": 200, "message": "已取消订阅"})
+}
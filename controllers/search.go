@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"yinyue/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// searchTimeout 单个音源的搜索超时
+const searchTimeout = 8 * time.Second
+
+// searchClient 搜索请求使用的 HTTP 客户端，避免某个音源无响应时拖住整个请求
+var searchClient = &http.Client{Timeout: searchTimeout}
+
+// AggregateSong 聚合搜索结果中的歌曲
+type AggregateSong struct {
+	models.Song
+	Rank       int     `json:"rank"`      // 在该音源结果中的名次，从 1 开始
+	Score      float64 `json:"score"`     // 综合排序分数
+	Group      int     `json:"group"`     // 跨音源重复分组，同组视为同一首歌
+	Duplicate  bool    `json:"duplicate"` // 同组中已有排名更靠前的结果
+	Downloaded bool    `json:"downloaded"`
+}
+
+// SourceStatus 单个音源的搜索情况
+type SourceStatus struct {
+	Source  string `json:"source"`
+	OK      bool   `json:"ok"`
+	Count   int    `json:"count"`
+	Error   string `json:"error,omitempty"`
+	Cache   string `json:"cache,omitempty"` // 缓存状态 (HIT/MISS/STALE)
+	Elapsed int64  `json:"elapsed"`         // 毫秒
+}
+
+// AggregateSearchResult 聚合搜索结果
+type AggregateSearchResult struct {
+	Keyword string          `json:"keyword"`
+	Results []AggregateSong `json:"results"`
+	Sources []SourceStatus  `json:"sources"`
+	Failed  []string        `json:"failed"`
+	Stale   bool            `json:"stale"` // 部分音源的结果来自过期缓存
+}
+
+// aggregateSearch 并发搜索多个音源，合并排序并标记跨音源重复的歌曲
+func aggregateSearch(keyword string, sources []string, limit int) AggregateSearchResult {
+	result := AggregateSearchResult{
+		Keyword: keyword,
+		Results: []AggregateSong{},
+		Sources: make([]SourceStatus, len(sources)),
+		Failed:  []string{},
+	}
+
+	found := make([][]models.Song, len(sources))
+	var (
+		wg         sync.WaitGroup
+		staleMutex sync.Mutex
+	)
+	for i, source := range sources {
+		wg.Add(1)
+		go func(i int, source string) {
+			defer wg.Done()
+			start := time.Now()
+			songs, cache, err := searchSongs(source, keyword, limit)
+			status := SourceStatus{
+				Source:  source,
+				OK:      err == nil,
+				Count:   len(songs),
+				Cache:   cache.State,
+				Elapsed: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				status.Error = err.Error()
+			}
+			result.Sources[i] = status
+			found[i] = songs
+			if cache.State == cacheStale {
+				staleMutex.Lock()
+				result.Stale = true
+				staleMutex.Unlock()
+			}
+		}(i, source)
+	}
+	wg.Wait()
+
+	for i, songs := range found {
+		if !result.Sources[i].OK {
+			result.Failed = append(result.Failed, sources[i])
+			continue
+		}
+		for rank, s := range songs {
+			result.Results = append(result.Results, AggregateSong{
+				Song:  s,
+				Rank:  rank + 1,
+				Score: searchScore(keyword, s, rank, len(songs)),
+			})
+		}
+	}
+
+	sourceOrder := make(map[string]int, len(sources))
+	for i, s := range sources {
+		sourceOrder[s] = i
+	}
+	sort.SliceStable(result.Results, func(i, j int) bool {
+		a, b := result.Results[i], result.Results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Rank != b.Rank {
+			return a.Rank < b.Rank
+		}
+		return sourceOrder[a.Source] < sourceOrder[b.Source]
+	})
+
+	markDuplicates(result.Results)
+	markDownloaded(result.Results)
+	return result
+}
+
+// searchScore 综合关键词相关度与上游名次计算排序分数 (0~1)
+func searchScore(keyword string, s models.Song, rank, total int) float64 {
+	relevance := max(
+		similarity(keyword, s.Name),
+		similarity(keyword, s.Artist+s.Name),
+		similarity(keyword, s.Name+s.Artist),
+	)
+	position := 1 - float64(rank)/float64(total)
+	return relevance*0.7 + position*0.3
+}
+
+// markDuplicates 将不同音源中标题、艺术家（及已知时长）一致的歌曲分为一组，
+// 每组排名最靠前的一首为主结果，其余标记为重复；结果需已按分数排序
+func markDuplicates(songs []AggregateSong) {
+	var heads []int
+	for i := range songs {
+		group := 0
+		for _, h := range heads {
+			if sameSong(songs[h], songs[i]) && !groupHasSource(songs[:i], songs[h].Group, songs[i].Source) {
+				group = songs[h].Group
+				break
+			}
+		}
+		if group == 0 {
+			heads = append(heads, i)
+			songs[i].Group = len(heads)
+			continue
+		}
+		songs[i].Group = group
+		songs[i].Duplicate = true
+	}
+}
+
+// sameSong 判断两首歌是否为同一首
+func sameSong(a, b AggregateSong) bool {
+	if a.Source == b.Source {
+		return false
+	}
+	if string(normalizeMatch(bracketPattern.ReplaceAllString(a.Name, ""))) !=
+		string(normalizeMatch(bracketPattern.ReplaceAllString(b.Name, ""))) {
+		return false
+	}
+	if artistSimilarity(a.Artist, b.Artist) < 0.8 {
+		return false
+	}
+	return a.Duration == 0 || b.Duration == 0 || absInt(a.Duration-b.Duration) <= durationTolerance
+}
+
+// groupHasSource 分组中是否已有该音源的歌曲，同一音源的不同版本不视为重复
+func groupHasSource(songs []AggregateSong, group int, source string) bool {
+	for _, s := range songs {
+		if s.Group == group && s.Source == source {
+			return true
+		}
+	}
+	return false
+}
+
+// markDownloaded 标记已在音乐库中的歌曲
+func markDownloaded(songs []AggregateSong) {
+	libMutex.RLock()
+	defer libMutex.RUnlock()
+
+	downloaded := make(map[string]bool, len(downloadedSongs))
+	for _, s := range downloadedSongs {
+		downloaded[s.Source+"_"+s.ID] = true
+	}
+	for i := range songs {
+		songs[i].Downloaded = downloaded[songs[i].Source+"_"+songs[i].ID]
+	}
+}
+
+// searchAllSources 聚合搜索 (source=all)，可用 sources 参数限定音源
+func searchAllSources(c *gin.Context, keyword string) {
+	sources := importSources(c.Query("sources"))
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+
+	result := aggregateSearch(keyword, sources, limit)
+	if len(result.Failed) == len(sources) {
+		c.JSON(502, models.Response{Code: 502, Message: "搜索失败", Data: result})
+		return
+	}
+	c.JSON(200, models.Success(result))
+}
@@ -0,0 +1,245 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxShareRedirects 解析短链接时最多跟随的跳转次数
+const maxShareRedirects = 5
+
+var (
+	errNoShareLink       = errors.New("未找到链接，请粘贴网易云音乐、QQ音乐或酷我音乐的歌单分享链接")
+	errUnsupportedLink   = errors.New("不支持的链接，目前仅支持网易云音乐、QQ音乐和酷我音乐的歌单")
+	errNoPlaylistID      = errors.New("链接中未找到歌单ID，请确认分享的是歌单而不是单曲或专辑")
+	errResolveShortLink  = errors.New("短链接解析失败，请稍后重试或粘贴完整链接")
+	shareURLPattern      = regexp.MustCompile(`https?://[^\s"'<>，。；、）)]+`)
+	bareHostPattern      = regexp.MustCompile(`(?i)\b(?:[a-z0-9-]+\.)*(?:163\.com|163cn\.tv|163\.fm|qq\.com|url\.cn|kuwo\.cn)/[^\s"'<>，。；、）)]*`)
+	playlistPathPatterns = map[string]*regexp.Regexp{
+		"netease": regexp.MustCompile(`/playlist/(\d+)`),
+		"qq":      regexp.MustCompile(`/playlist/(\d+)`),
+		"kuwo":    regexp.MustCompile(`/playlist(?:_detail)?/(\d+)`),
+	}
+	playlistQueryKeys = map[string][]string{
+		"netease": {"id"},
+		"qq":      {"id", "disstid", "dissid"},
+		"kuwo":    {"pid", "id"},
+	}
+	numericID = regexp.MustCompile(`^\d+$`)
+)
+
+// shareLinkSources 域名与音源的对应关系（按域名后缀匹配）
+var shareLinkSources = []struct {
+	domain string
+	source string
+}{
+	{"163.com", "netease"},
+	{"163cn.tv", "netease"},
+	{"163.fm", "netease"},
+	{"qq.com", "qq"},
+	{"url.cn", "qq"},
+	{"kuwo.cn", "kuwo"},
+}
+
+// shortLinkHosts 短链接域名，只有这些链接会跟随跳转解析
+var shortLinkHosts = map[string]bool{
+	"163cn.tv":    true,
+	"163.fm":      true,
+	"url.cn":      true,
+	"c.y.qq.com":  true,
+	"c6.y.qq.com": true,
+}
+
+// linkSource 根据域名识别音源
+func linkSource(host string) string {
+	host = strings.ToLower(host)
+	for _, s := range shareLinkSources {
+		if host == s.domain || strings.HasSuffix(host, "."+s.domain) {
+			return s.source
+		}
+	}
+	return ""
+}
+
+// extractShareURL 从分享文本中提取第一个链接
+func extractShareURL(text string) string {
+	if u := shareURLPattern.FindString(text); u != "" {
+		return u
+	}
+	// 部分客户端复制的链接不带协议头
+	if u := bareHostPattern.FindString(text); u != "" {
+		return "https://" + u
+	}
+	return ""
+}
+
+// playlistIDFromURL 从完整链接中取出歌单ID，网易云的 #/playlist?id= 形式也会处理
+func playlistIDFromURL(source string, u *url.URL) string {
+	paths := []string{u.Path}
+	queries := []url.Values{u.Query()}
+	if u.Fragment != "" {
+		fragPath, fragQuery, _ := strings.Cut(u.Fragment, "?")
+		paths = append(paths, fragPath)
+		if q, err := url.ParseQuery(fragQuery); err == nil {
+			queries = append(queries, q)
+		}
+	}
+
+	isPlaylistPage := false
+	for _, p := range paths {
+		if m := playlistPathPatterns[source].FindStringSubmatch(p); m != nil {
+			return m[1]
+		}
+		lower := strings.ToLower(p)
+		if strings.Contains(lower, "playlist") || strings.Contains(lower, "taoge") {
+			isPlaylistPage = true
+		}
+	}
+
+	for _, q := range queries {
+		for _, key := range playlistQueryKeys[source] {
+			v := q.Get(key)
+			if !numericID.MatchString(v) {
+				continue
+			}
+			// id 参数在单曲、专辑页面中同样存在，只在歌单页面中使用
+			if key == "id" && !isPlaylistPage {
+				continue
+			}
+			return v
+		}
+	}
+	return ""
+}
+
+// resolveShortLink 跟随跳转得到最终地址，跳转后的页面中若含有歌单链接也会一并返回
+func resolveShortLink(link string) ([]string, error) {
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxShareRedirects {
+				return http.ErrUseLastResponse
+			}
+			if linkSource(req.URL.Hostname()) == "" {
+				return errUnsupportedLink
+			}
+			return nil
+		},
+	}
+
+	req, err := http.NewRequest("GET", link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 16_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	links := []string{resp.Request.URL.String()}
+	if location := resp.Header.Get("Location"); location != "" {
+		links = append(links, location)
+	}
+
+	// 有的短链接通过页面脚本跳转，在页面前部查找链接
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	for _, u := range shareURLPattern.FindAllString(strings.ReplaceAll(string(body), `\/`, `/`), -1) {
+		if parsed, err := url.Parse(u); err == nil && linkSource(parsed.Hostname()) != "" {
+			links = append(links, u)
+		}
+	}
+	return links, nil
+}
+
+// parseShareLink 从分享链接或分享文本中识别音源和歌单ID
+func parseShareLink(text string) (source, id string, err error) {
+	link := extractShareURL(text)
+	if link == "" {
+		return "", "", errNoShareLink
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", "", errUnsupportedLink
+	}
+	source = linkSource(u.Hostname())
+	if source == "" {
+		return "", "", errUnsupportedLink
+	}
+	if id = playlistIDFromURL(source, u); id != "" {
+		return source, id, nil
+	}
+
+	if !shortLinkHosts[strings.ToLower(u.Hostname())] {
+		return "", "", errNoPlaylistID
+	}
+
+	// 短链接，跟随跳转后重新识别
+	links, err := resolveShortLink(link)
+	if err != nil {
+		if errors.Is(err, errUnsupportedLink) {
+			return "", "", errUnsupportedLink
+		}
+		return "", "", errResolveShortLink
+	}
+	for _, l := range links {
+		resolved, err := url.Parse(l)
+		if err != nil {
+			continue
+		}
+		resolvedSource := linkSource(resolved.Hostname())
+		if resolvedSource == "" {
+			continue
+		}
+		if id = playlistIDFromURL(resolvedSource, resolved); id != "" {
+			return resolvedSource, id, nil
+		}
+	}
+	return "", "", errNoPlaylistID
+}
+
+// ImportPlaylistLink 通过分享链接或分享文本导入歌单，自动识别音源和歌单ID
+func ImportPlaylistLink(c *gin.Context) {
+	var req struct {
+		Link   string `json:"link"`
+		Source string `json:"source"`
+		ID     string `json:"id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 400, "message": "参数错误"})
+		return
+	}
+
+	// 兼容直接传入 source + id
+	if req.Source != "" && req.ID != "" {
+		respondImport(c, req.Source, req.ID)
+		return
+	}
+	if strings.TrimSpace(req.Link) == "" {
+		c.JSON(400, gin.H{"code": 400, "message": "缺少参数"})
+		return
+	}
+
+	source, id, err := parseShareLink(req.Link)
+	if err != nil {
+		// 短链接解析失败是网络问题，不是链接本身有误
+		status := 400
+		if errors.Is(err, errResolveShortLink) {
+			status = 502
+		}
+		c.JSON(status, gin.H{"code": status, "message": err.Error()})
+		return
+	}
+
+	respondImport(c, source, id)
+}
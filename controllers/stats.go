@@ -0,0 +1,26 @@
+package controllers
+
+import (
+	"strconv"
+
+	"yinyue/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetLibraryStats 获取音乐库统计
+func GetLibraryStats(c *gin.Context) {
+	top, err := strconv.Atoi(c.DefaultQuery("top", "10"))
+	if err != nil || top <= 0 {
+		c.JSON(400, gin.H{"code": 400, "message": "参数错误"})
+		return
+	}
+
+	stats, err := storage.GetLibraryStats(top)
+	if err != nil {
+		c.JSON(500, gin.H{"code": 500, "message": "统计失败"})
+		return
+	}
+
+	c.JSON(200, gin.H{"code": 200, "data": stats})
+}
@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// audioContentTypes 常见音频扩展名对应的 Content-Type
+var audioContentTypes = map[string]string{
+	".mp3":  "audio/mpeg",
+	".flac": "audio/flac",
+	".m4a":  "audio/mp4",
+	".ogg":  "audio/ogg",
+	".wav":  "audio/wav",
+}
+
+// findLibrarySong 在音乐库中查找歌曲
+func findLibrarySong(source, id string) (DownloadedSong, bool) {
+	libMutex.RLock()
+	defer libMutex.RUnlock()
+
+	for _, song := range downloadedSongs {
+		if song.ID == id && song.Source == source {
+			return song, true
+		}
+	}
+	return DownloadedSong{}, false
+}
+
+// StreamLibrarySong 播放音乐库中的本地文件，支持 Range 请求
+func StreamLibrarySong(c *gin.Context) {
+	source := c.Param("source")
+	id := c.Param("id")
+
+	song, ok := findLibrarySong(source, id)
+	if !ok {
+		c.JSON(404, gin.H{"code": 404, "message": "歌曲未下载"})
+		return
+	}
+
+	serveAudioFile(c, song.Path)
+}
+
+// serveAudioFile 以 Range/ETag/Last-Modified 方式输出音频文件
+func serveAudioFile(c *gin.Context, path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		c.JSON(404, gin.H{"code": 404, "message": "文件不存在"})
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		c.JSON(404, gin.H{"code": 404, "message": "文件不存在"})
+		return
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	contentType := audioContentTypes[ext]
+	if contentType == "" {
+		contentType = mime.TypeByExtension(ext)
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("ETag", fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano()))
+	// ServeContent 负责 Range、If-Range、If-None-Match 与 Last-Modified
+	http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), file)
+}
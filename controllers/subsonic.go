@@ -0,0 +1,782 @@
+package controllers
+
+import (
+	"crypto/md5"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"yinyue/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Subsonic 协议版本
+const (
+	subsonicAPIVersion = "1.16.1"
+	subsonicServerName = "tunehub"
+	subsonicFolderID   = 1
+)
+
+// Subsonic 错误码
+const (
+	subsonicErrGeneric      = 0
+	subsonicErrMissingParam = 10
+	subsonicErrAuth         = 40
+	subsonicErrNotFound     = 70
+)
+
+// subsonicResponse Subsonic 响应，同时支持 XML 与 JSON
+type subsonicResponse struct {
+	XMLName       xml.Name `xml:"subsonic-response" json:"-"`
+	Xmlns         string   `xml:"xmlns,attr" json:"-"`
+	Status        string   `xml:"status,attr" json:"status"`
+	Version       string   `xml:"version,attr" json:"version"`
+	Type          string   `xml:"type,attr" json:"type"`
+	ServerVersion string   `xml:"serverVersion,attr" json:"serverVersion"`
+	OpenSubsonic  bool     `xml:"openSubsonic,attr" json:"openSubsonic"`
+
+	Error         *subsonicError     `xml:"error,omitempty" json:"error,omitempty"`
+	License       *subsonicLicense   `xml:"license,omitempty" json:"license,omitempty"`
+	MusicFolders  *subsonicFolders   `xml:"musicFolders,omitempty" json:"musicFolders,omitempty"`
+	Indexes       *subsonicIndexes   `xml:"indexes,omitempty" json:"indexes,omitempty"`
+	Directory     *subsonicDirectory `xml:"directory,omitempty" json:"directory,omitempty"`
+	Artists       *subsonicIndexes   `xml:"artists,omitempty" json:"artists,omitempty"`
+	Artist        *subsonicArtist    `xml:"artist,omitempty" json:"artist,omitempty"`
+	Album         *subsonicAlbum     `xml:"album,omitempty" json:"album,omitempty"`
+	Song          *subsonicSong      `xml:"song,omitempty" json:"song,omitempty"`
+	SearchResult3 *subsonicSearch    `xml:"searchResult3,omitempty" json:"searchResult3,omitempty"`
+	Playlists     *subsonicPlaylists `xml:"playlists,omitempty" json:"playlists,omitempty"`
+	Playlist      *subsonicPlaylist  `xml:"playlist,omitempty" json:"playlist,omitempty"`
+}
+
+type subsonicError struct {
+	Code    int    `xml:"code,attr" json:"code"`
+	Message string `xml:"message,attr" json:"message"`
+}
+
+type subsonicLicense struct {
+	Valid bool `xml:"valid,attr" json:"valid"`
+}
+
+type subsonicFolders struct {
+	Folders []subsonicFolder `xml:"musicFolder" json:"musicFolder"`
+}
+
+type subsonicFolder struct {
+	ID   int    `xml:"id,attr" json:"id"`
+	Name string `xml:"name,attr" json:"name"`
+}
+
+type subsonicIndexes struct {
+	LastModified    int64           `xml:"lastModified,attr,omitempty" json:"lastModified,omitempty"`
+	IgnoredArticles string          `xml:"ignoredArticles,attr" json:"ignoredArticles"`
+	Index           []subsonicIndex `xml:"index" json:"index"`
+}
+
+type subsonicIndex struct {
+	Name    string           `xml:"name,attr" json:"name"`
+	Artists []subsonicArtist `xml:"artist" json:"artist"`
+}
+
+type subsonicArtist struct {
+	ID         string          `xml:"id,attr" json:"id"`
+	Name       string          `xml:"name,attr" json:"name"`
+	AlbumCount int             `xml:"albumCount,attr" json:"albumCount"`
+	CoverArt   string          `xml:"coverArt,attr,omitempty" json:"coverArt,omitempty"`
+	Albums     []subsonicAlbum `xml:"album,omitempty" json:"album,omitempty"`
+}
+
+type subsonicAlbum struct {
+	ID        string         `xml:"id,attr" json:"id"`
+	Name      string         `xml:"name,attr" json:"name"`
+	Artist    string         `xml:"artist,attr" json:"artist"`
+	ArtistID  string         `xml:"artistId,attr" json:"artistId"`
+	CoverArt  string         `xml:"coverArt,attr,omitempty" json:"coverArt,omitempty"`
+	SongCount int            `xml:"songCount,attr" json:"songCount"`
+	Duration  int            `xml:"duration,attr" json:"duration"`
+	Created   string         `xml:"created,attr" json:"created"`
+	Songs     []subsonicSong `xml:"song,omitempty" json:"song,omitempty"`
+}
+
+type subsonicSong struct {
+	ID          string `xml:"id,attr" json:"id"`
+	Parent      string `xml:"parent,attr,omitempty" json:"parent,omitempty"`
+	IsDir       bool   `xml:"isDir,attr" json:"isDir"`
+	Title       string `xml:"title,attr" json:"title"`
+	Album       string `xml:"album,attr,omitempty" json:"album,omitempty"`
+	Artist      string `xml:"artist,attr,omitempty" json:"artist,omitempty"`
+	CoverArt    string `xml:"coverArt,attr,omitempty" json:"coverArt,omitempty"`
+	Size        int64  `xml:"size,attr,omitempty" json:"size,omitempty"`
+	Duration    int    `xml:"duration,attr,omitempty" json:"duration,omitempty"`
+	ContentType string `xml:"contentType,attr,omitempty" json:"contentType,omitempty"`
+	Suffix      string `xml:"suffix,attr,omitempty" json:"suffix,omitempty"`
+	Path        string `xml:"path,attr,omitempty" json:"path,omitempty"`
+	Created     string `xml:"created,attr,omitempty" json:"created,omitempty"`
+	AlbumID     string `xml:"albumId,attr,omitempty" json:"albumId,omitempty"`
+	ArtistID    string `xml:"artistId,attr,omitempty" json:"artistId,omitempty"`
+	Type        string `xml:"type,attr,omitempty" json:"type,omitempty"`
+}
+
+type subsonicDirectory struct {
+	ID       string         `xml:"id,attr" json:"id"`
+	Parent   string         `xml:"parent,attr,omitempty" json:"parent,omitempty"`
+	Name     string         `xml:"name,attr" json:"name"`
+	Children []subsonicSong `xml:"child" json:"child"`
+}
+
+type subsonicSearch struct {
+	Artists []subsonicArtist `xml:"artist" json:"artist"`
+	Albums  []subsonicAlbum  `xml:"album" json:"album"`
+	Songs   []subsonicSong   `xml:"song" json:"song"`
+}
+
+type subsonicPlaylists struct {
+	Playlists []subsonicPlaylist `xml:"playlist" json:"playlist"`
+}
+
+type subsonicPlaylist struct {
+	ID        string         `xml:"id,attr" json:"id"`
+	Name      string         `xml:"name,attr" json:"name"`
+	Comment   string         `xml:"comment,attr,omitempty" json:"comment,omitempty"`
+	Owner     string         `xml:"owner,attr" json:"owner"`
+	Public    bool           `xml:"public,attr" json:"public"`
+	SongCount int            `xml:"songCount,attr" json:"songCount"`
+	Duration  int            `xml:"duration,attr" json:"duration"`
+	Created   string         `xml:"created,attr" json:"created"`
+	Changed   string         `xml:"changed,attr" json:"changed"`
+	Entries   []subsonicSong `xml:"entry,omitempty" json:"entry,omitempty"`
+}
+
+// newSubsonicResponse 创建成功响应
+func newSubsonicResponse() *subsonicResponse {
+	return &subsonicResponse{
+		Xmlns:         "http://subsonic.org/restapi",
+		Status:        "ok",
+		Version:       subsonicAPIVersion,
+		Type:          subsonicServerName,
+		ServerVersion: "1.0.0",
+		OpenSubsonic:  true,
+	}
+}
+
+// subsonicParam 读取参数（兼容 GET 查询参数与 POST 表单）
+func subsonicParam(c *gin.Context, key string) string {
+	return c.Request.FormValue(key)
+}
+
+// jsonpCallbackPattern 合法的 JSONP 回调函数名，避免输出任意脚本
+var jsonpCallbackPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$.]*$`)
+
+// writeSubsonic 按 f 参数输出 XML 或 JSON，回调函数名不合法的 JSONP 请求按 JSON 输出
+func writeSubsonic(c *gin.Context, resp *subsonicResponse) {
+	format := subsonicParam(c, "f")
+	callback := subsonicParam(c, "callback")
+	if format == "jsonp" && !jsonpCallbackPattern.MatchString(callback) {
+		format = "json"
+	}
+
+	switch format {
+	case "json":
+		c.JSON(200, gin.H{"subsonic-response": resp})
+	case "jsonp":
+		body, _ := json.Marshal(gin.H{"subsonic-response": resp})
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Data(200, "application/javascript; charset=utf-8", []byte(callback+"("+string(body)+");"))
+	default:
+		body, _ := xml.Marshal(resp)
+		c.Data(200, "application/xml; charset=utf-8", append([]byte(xml.Header), body...))
+	}
+}
+
+// subsonicFail 输出 Subsonic 错误（协议要求 HTTP 状态码仍为 200）
+func subsonicFail(c *gin.Context, code int, message string) {
+	resp := newSubsonicResponse()
+	resp.Status = "failed"
+	resp.Error = &subsonicError{Code: code, Message: message}
+	writeSubsonic(c, resp)
+	c.Abort()
+}
+
+// SubsonicAuth Subsonic 身份验证中间件，支持 token/salt 与明文密码
+func SubsonicAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		settings := storage.GetSettings()
+		if settings.SubsonicPassword == "" {
+			subsonicFail(c, subsonicErrAuth, "Subsonic 接口未启用，请先在设置中配置密码")
+			return
+		}
+
+		user := subsonicParam(c, "u")
+		token := subsonicParam(c, "t")
+		salt := subsonicParam(c, "s")
+		password := subsonicParam(c, "p")
+
+		if user == "" || (password == "" && (token == "" || salt == "")) {
+			subsonicFail(c, subsonicErrMissingParam, "缺少认证参数")
+			return
+		}
+
+		ok := false
+		if token != "" && salt != "" {
+			sum := md5.Sum([]byte(settings.SubsonicPassword + salt))
+			ok = subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(strings.ToLower(token))) == 1
+		} else {
+			if strings.HasPrefix(password, "enc:") {
+				if decoded, err := hex.DecodeString(password[4:]); err == nil {
+					password = string(decoded)
+				}
+			}
+			ok = subtle.ConstantTimeCompare([]byte(password), []byte(settings.SubsonicPassword)) == 1
+		}
+
+		if !ok || user != settings.SubsonicUser {
+			subsonicFail(c, subsonicErrAuth, "用户名或密码错误")
+			return
+		}
+		c.Next()
+	}
+}
+
+// encodeSubsonicID 将来源信息编码为 Subsonic ID
+func encodeSubsonicID(kind string, parts ...string) string {
+	return kind + "-" + base64.RawURLEncoding.EncodeToString([]byte(strings.Join(parts, "\x00")))
+}
+
+// decodeSubsonicID 解析 Subsonic ID
+func decodeSubsonicID(id, kind string, n int) ([]string, bool) {
+	if !strings.HasPrefix(id, kind+"-") {
+		return nil, false
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(id[len(kind)+1:])
+	if err != nil {
+		return nil, false
+	}
+	parts := strings.Split(string(raw), "\x00")
+	if len(parts) != n {
+		return nil, false
+	}
+	return parts, true
+}
+
+func songSubsonicID(source, id string) string { return encodeSubsonicID("so", source, id) }
+func artistSubsonicID(artist string) string   { return encodeSubsonicID("ar", artist) }
+func albumSubsonicID(artist, album string) string {
+	return encodeSubsonicID("al", artist, album)
+}
+
+// subsonicTime 将音乐库时间转为 ISO 8601
+func subsonicTime(t string) string {
+	parsed, err := time.ParseInLocation("2006-01-02 15:04", t, time.Local)
+	if err != nil {
+		return ""
+	}
+	return parsed.Format(time.RFC3339)
+}
+
+// toSubsonicSong 转换音乐库歌曲
+func toSubsonicSong(song storage.DownloadedSong) subsonicSong {
+	suffix := strings.TrimPrefix(strings.ToLower(filepath.Ext(song.Path)), ".")
+	return subsonicSong{
+		ID:          songSubsonicID(song.Source, song.ID),
+		Parent:      albumSubsonicID(song.Artist, song.Album),
+		Title:       song.Name,
+		Album:       song.Album,
+		Artist:      song.Artist,
+		CoverArt:    songSubsonicID(song.Source, song.ID),
+		Size:        song.Size,
+		Duration:    song.Duration,
+		ContentType: audioContentTypes["."+suffix],
+		Suffix:      suffix,
+		Path:        song.Filename,
+		Created:     subsonicTime(song.Time),
+		AlbumID:     albumSubsonicID(song.Artist, song.Album),
+		ArtistID:    artistSubsonicID(song.Artist),
+		Type:        "music",
+	}
+}
+
+// subsonicLibrary 音乐库按艺术家、专辑分组
+type subsonicLibrary struct {
+	songs   []storage.DownloadedSong
+	artists map[string]map[string][]storage.DownloadedSong // artist -> album -> songs
+}
+
+func loadSubsonicLibrary() *subsonicLibrary {
+	lib := &subsonicLibrary{
+		songs:   storage.GetLibrary(),
+		artists: make(map[string]map[string][]storage.DownloadedSong),
+	}
+	for _, song := range lib.songs {
+		albums, ok := lib.artists[song.Artist]
+		if !ok {
+			albums = make(map[string][]storage.DownloadedSong)
+			lib.artists[song.Artist] = albums
+		}
+		albums[song.Album] = append(albums[song.Album], song)
+	}
+	return lib
+}
+
+// artist 生成艺术家条目（含专辑列表）
+func (lib *subsonicLibrary) artist(name string, withAlbums bool) subsonicArtist {
+	albums := lib.artists[name]
+	a := subsonicArtist{
+		ID:         artistSubsonicID(name),
+		Name:       name,
+		AlbumCount: len(albums),
+	}
+	for _, albumName := range sortedKeys(albums) {
+		album := lib.album(name, albumName, false)
+		if a.CoverArt == "" {
+			a.CoverArt = album.CoverArt
+		}
+		if withAlbums {
+			a.Albums = append(a.Albums, album)
+		}
+	}
+	return a
+}
+
+// album 生成专辑条目
+func (lib *subsonicLibrary) album(artist, name string, withSongs bool) subsonicAlbum {
+	songs := lib.artists[artist][name]
+	a := subsonicAlbum{
+		ID:        albumSubsonicID(artist, name),
+		Name:      name,
+		Artist:    artist,
+		ArtistID:  artistSubsonicID(artist),
+		SongCount: len(songs),
+	}
+	if a.Name == "" {
+		a.Name = "未知专辑"
+	}
+	for _, song := range songs {
+		if a.CoverArt == "" {
+			a.CoverArt = songSubsonicID(song.Source, song.ID)
+		}
+		if created := subsonicTime(song.Time); a.Created == "" || created < a.Created {
+			a.Created = created
+		}
+		a.Duration += song.Duration
+		if withSongs {
+			a.Songs = append(a.Songs, toSubsonicSong(song))
+		}
+	}
+	return a
+}
+
+// indexes 按首字母分组艺术家
+func (lib *subsonicLibrary) indexes() *subsonicIndexes {
+	groups := make(map[string][]subsonicArtist)
+	for _, name := range sortedKeys(lib.artists) {
+		key := "#"
+		if r := []rune(strings.TrimSpace(name)); len(r) > 0 && r[0] < unicode.MaxASCII && unicode.IsLetter(r[0]) {
+			key = strings.ToUpper(string(r[0]))
+		}
+		groups[key] = append(groups[key], lib.artist(name, false))
+	}
+
+	result := &subsonicIndexes{
+		LastModified:    time.Now().UnixMilli(),
+		IgnoredArticles: "The El La Los Las Le Les",
+		Index:           []subsonicIndex{},
+	}
+	for _, key := range sortedKeys(groups) {
+		result.Index = append(result.Index, subsonicIndex{Name: key, Artists: groups[key]})
+	}
+	return result
+}
+
+// findSong 根据 Subsonic ID 查找歌曲
+func (lib *subsonicLibrary) findSong(id string) (storage.DownloadedSong, bool) {
+	parts, ok := decodeSubsonicID(id, "so", 2)
+	if !ok {
+		return storage.DownloadedSong{}, false
+	}
+	for _, song := range lib.songs {
+		if song.Source == parts[0] && song.ID == parts[1] {
+			return song, true
+		}
+	}
+	return storage.DownloadedSong{}, false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SubsonicPing 连通性测试
+func SubsonicPing(c *gin.Context) {
+	writeSubsonic(c, newSubsonicResponse())
+}
+
+// SubsonicGetLicense 许可证（始终有效）
+func SubsonicGetLicense(c *gin.Context) {
+	resp := newSubsonicResponse()
+	resp.License = &subsonicLicense{Valid: true}
+	writeSubsonic(c, resp)
+}
+
+// SubsonicGetMusicFolders 音乐文件夹（只有一个音乐库）
+func SubsonicGetMusicFolders(c *gin.Context) {
+	resp := newSubsonicResponse()
+	resp.MusicFolders = &subsonicFolders{
+		Folders: []subsonicFolder{{ID: subsonicFolderID, Name: "TuneHub"}},
+	}
+	writeSubsonic(c, resp)
+}
+
+// SubsonicGetIndexes 按文件夹方式浏览的艺术家索引
+func SubsonicGetIndexes(c *gin.Context) {
+	resp := newSubsonicResponse()
+	resp.Indexes = loadSubsonicLibrary().indexes()
+	writeSubsonic(c, resp)
+}
+
+// SubsonicGetMusicDirectory 按文件夹方式浏览艺术家或专辑
+func SubsonicGetMusicDirectory(c *gin.Context) {
+	id := subsonicParam(c, "id")
+	lib := loadSubsonicLibrary()
+	resp := newSubsonicResponse()
+
+	if parts, ok := decodeSubsonicID(id, "ar", 1); ok {
+		if _, exists := lib.artists[parts[0]]; exists {
+			dir := &subsonicDirectory{ID: id, Name: parts[0], Children: []subsonicSong{}}
+			for _, album := range lib.artist(parts[0], true).Albums {
+				dir.Children = append(dir.Children, subsonicSong{
+					ID:       album.ID,
+					Parent:   id,
+					IsDir:    true,
+					Title:    album.Name,
+					Artist:   album.Artist,
+					CoverArt: album.CoverArt,
+				})
+			}
+			resp.Directory = dir
+			writeSubsonic(c, resp)
+			return
+		}
+	}
+
+	if parts, ok := decodeSubsonicID(id, "al", 2); ok {
+		if _, exists := lib.artists[parts[0]][parts[1]]; exists {
+			album := lib.album(parts[0], parts[1], true)
+			resp.Directory = &subsonicDirectory{
+				ID:       id,
+				Parent:   artistSubsonicID(parts[0]),
+				Name:     album.Name,
+				Children: album.Songs,
+			}
+			writeSubsonic(c, resp)
+			return
+		}
+	}
+
+	subsonicFail(c, subsonicErrNotFound, "目录不存在")
+}
+
+// SubsonicGetArtists 按 ID3 标签浏览的艺术家索引
+func SubsonicGetArtists(c *gin.Context) {
+	resp := newSubsonicResponse()
+	resp.Artists = loadSubsonicLibrary().indexes()
+	resp.Artists.LastModified = 0
+	writeSubsonic(c, resp)
+}
+
+// SubsonicGetArtist 艺术家详情及专辑
+func SubsonicGetArtist(c *gin.Context) {
+	parts, ok := decodeSubsonicID(subsonicParam(c, "id"), "ar", 1)
+	lib := loadSubsonicLibrary()
+	if !ok || lib.artists[parts[0]] == nil {
+		subsonicFail(c, subsonicErrNotFound, "艺术家不存在")
+		return
+	}
+
+	artist := lib.artist(parts[0], true)
+	resp := newSubsonicResponse()
+	resp.Artist = &artist
+	writeSubsonic(c, resp)
+}
+
+// SubsonicGetAlbum 专辑详情及歌曲
+func SubsonicGetAlbum(c *gin.Context) {
+	parts, ok := decodeSubsonicID(subsonicParam(c, "id"), "al", 2)
+	lib := loadSubsonicLibrary()
+	if !ok || lib.artists[parts[0]][parts[1]] == nil {
+		subsonicFail(c, subsonicErrNotFound, "专辑不存在")
+		return
+	}
+
+	album := lib.album(parts[0], parts[1], true)
+	resp := newSubsonicResponse()
+	resp.Album = &album
+	writeSubsonic(c, resp)
+}
+
+// SubsonicGetSong 歌曲详情
+func SubsonicGetSong(c *gin.Context) {
+	song, ok := loadSubsonicLibrary().findSong(subsonicParam(c, "id"))
+	if !ok {
+		subsonicFail(c, subsonicErrNotFound, "歌曲不存在")
+		return
+	}
+
+	s := toSubsonicSong(song)
+	resp := newSubsonicResponse()
+	resp.Song = &s
+	writeSubsonic(c, resp)
+}
+
+// subsonicCount 读取分页参数
+func subsonicCount(c *gin.Context, key string, def int) int {
+	n, err := strconv.Atoi(subsonicParam(c, key))
+	if err != nil || n < 0 {
+		return def
+	}
+	return n
+}
+
+// paginate 按 count/offset 截取
+func paginate[T any](items []T, count, offset int) []T {
+	if offset >= len(items) {
+		return []T{}
+	}
+	items = items[offset:]
+	if count < len(items) {
+		items = items[:count]
+	}
+	return items
+}
+
+// SubsonicSearch3 搜索音乐库中的艺术家、专辑和歌曲
+func SubsonicSearch3(c *gin.Context) {
+	query := strings.ToLower(strings.Trim(subsonicParam(c, "query"), `" `))
+	lib := loadSubsonicLibrary()
+
+	// 空查询表示列出全部（部分客户端用于同步整个音乐库）
+	match := func(s string) bool {
+		return query == "" || strings.Contains(strings.ToLower(s), query)
+	}
+
+	result := &subsonicSearch{
+		Artists: []subsonicArtist{},
+		Albums:  []subsonicAlbum{},
+		Songs:   []subsonicSong{},
+	}
+	for _, artist := range sortedKeys(lib.artists) {
+		if match(artist) {
+			result.Artists = append(result.Artists, lib.artist(artist, false))
+		}
+		for _, album := range sortedKeys(lib.artists[artist]) {
+			if match(album) {
+				result.Albums = append(result.Albums, lib.album(artist, album, false))
+			}
+		}
+	}
+	for _, song := range lib.songs {
+		if match(song.Name) || match(song.Artist) || match(song.Album) {
+			result.Songs = append(result.Songs, toSubsonicSong(song))
+		}
+	}
+
+	result.Artists = paginate(result.Artists, subsonicCount(c, "artistCount", 20), subsonicCount(c, "artistOffset", 0))
+	result.Albums = paginate(result.Albums, subsonicCount(c, "albumCount", 20), subsonicCount(c, "albumOffset", 0))
+	result.Songs = paginate(result.Songs, subsonicCount(c, "songCount", 20), subsonicCount(c, "songOffset", 0))
+
+	resp := newSubsonicResponse()
+	resp.SearchResult3 = result
+	writeSubsonic(c, resp)
+}
+
+// SubsonicStream 播放音乐库中的文件（不转码）
+func SubsonicStream(c *gin.Context) {
+	song, ok := loadSubsonicLibrary().findSong(subsonicParam(c, "id"))
+	if !ok {
+		subsonicFail(c, subsonicErrNotFound, "歌曲不存在")
+		return
+	}
+	serveAudioFile(c, song.Path)
+}
+
+// SubsonicGetCoverArt 从上游获取歌曲封面
+func SubsonicGetCoverArt(c *gin.Context) {
+	parts, ok := decodeSubsonicID(subsonicParam(c, "id"), "so", 2)
+	if !ok {
+		subsonicFail(c, subsonicErrNotFound, "封面不存在")
+		return
+	}
+
+	image, err := fetchCoverArt(parts[0], parts[1])
+	if errors.Is(err, errCoverNotFound) {
+		subsonicFail(c, subsonicErrNotFound, "封面不存在")
+		return
+	}
+	if err != nil {
+		subsonicFail(c, subsonicErrGeneric, err.Error())
+		return
+	}
+
+	c.Header("Cache-Control", "max-age=86400")
+	c.Data(200, http.DetectContentType(image), image)
+}
+
+// errCoverNotFound 上游没有返回图片
+var errCoverNotFound = errors.New("封面不存在")
+
+// fetchCoverArt 获取歌曲封面，有效期内使用缓存
+func fetchCoverArt(source, id string) ([]byte, error) {
+	params := url.Values{}
+	params.Set("source", source)
+	params.Set("type", "pic")
+	params.Set("id", id)
+
+	key := params.Encode()
+	if entry, ok := storage.GetCache(key); ok && time.Since(entry.Time) < cacheTTL["pic"] {
+		return entry.Body, nil
+	}
+
+	status, body, err := getUpstream(upstreamClient, params)
+	if err != nil {
+		return nil, err
+	}
+	if status != 200 || !strings.HasPrefix(http.DetectContentType(body), "image/") {
+		return nil, errCoverNotFound
+	}
+
+	err = storage.SetCache(storage.CacheEntry{
+		Key:    key,
+		Type:   "pic",
+		Source: source,
+		Status: status,
+		Body:   body,
+		Time:   time.Now(),
+	})
+	if err != nil {
+		log.Printf("写入封面缓存失败 [%s/%s]: %v", source, id, err)
+	}
+	return body, nil
+}
+
+// toSubsonicPlaylist 转换歌单，只包含已下载的歌曲
+func toSubsonicPlaylist(p storage.Playlist, lib *subsonicLibrary, owner string, withSongs bool) subsonicPlaylist {
+	downloaded := make(map[string]storage.DownloadedSong, len(lib.songs))
+	for _, song := range lib.songs {
+		downloaded[song.Source+"_"+song.ID] = song
+	}
+
+	result := subsonicPlaylist{
+		ID:      encodeSubsonicID("pl", p.Source, p.ID),
+		Name:    p.Name,
+		Comment: p.Author,
+		Owner:   owner,
+	}
+	for _, s := range p.Songs {
+		song, ok := downloaded[s.Source+"_"+s.ID]
+		if !ok {
+			continue
+		}
+		result.SongCount++
+		result.Duration += song.Duration
+		if created := subsonicTime(song.Time); created > result.Changed {
+			result.Changed = created
+		}
+		if withSongs {
+			result.Entries = append(result.Entries, toSubsonicSong(song))
+		}
+	}
+	result.Created = result.Changed
+	if result.Created == "" {
+		result.Created = time.Now().Format(time.RFC3339)
+		result.Changed = result.Created
+	}
+	return result
+}
+
+// SubsonicGetPlaylists 歌单列表
+func SubsonicGetPlaylists(c *gin.Context) {
+	lib := loadSubsonicLibrary()
+	owner := subsonicParam(c, "u")
+
+	result := &subsonicPlaylists{Playlists: []subsonicPlaylist{}}
+	for _, p := range storage.GetPlaylists() {
+		result.Playlists = append(result.Playlists, toSubsonicPlaylist(p, lib, owner, false))
+	}
+
+	resp := newSubsonicResponse()
+	resp.Playlists = result
+	writeSubsonic(c, resp)
+}
+
+// SubsonicGetPlaylist 歌单详情
+func SubsonicGetPlaylist(c *gin.Context) {
+	parts, ok := decodeSubsonicID(subsonicParam(c, "id"), "pl", 2)
+	if !ok {
+		subsonicFail(c, subsonicErrNotFound, "歌单不存在")
+		return
+	}
+	p, ok := storage.GetPlaylist(parts[1], parts[0])
+	if !ok {
+		subsonicFail(c, subsonicErrNotFound, "歌单不存在")
+		return
+	}
+
+	playlist := toSubsonicPlaylist(p, loadSubsonicLibrary(), subsonicParam(c, "u"), true)
+	resp := newSubsonicResponse()
+	resp.Playlist = &playlist
+	writeSubsonic(c, resp)
+}
+
+// SubsonicScrobble 记录播放
+func SubsonicScrobble(c *gin.Context) {
+	c.Request.ParseForm()
+	ids := c.Request.Form["id"]
+	if len(ids) == 0 {
+		subsonicFail(c, subsonicErrMissingParam, "缺少参数 id")
+		return
+	}
+
+	// submission=false 表示"正在播放"通知，不记录
+	if subsonicParam(c, "submission") == "false" {
+		writeSubsonic(c, newSubsonicResponse())
+		return
+	}
+
+	times := c.Request.Form["time"]
+	for i, id := range ids {
+		parts, ok := decodeSubsonicID(id, "so", 2)
+		if !ok {
+			continue
+		}
+		playedAt := time.Now()
+		if i < len(times) {
+			if ms, err := strconv.ParseInt(times[i], 10, 64); err == nil {
+				playedAt = time.UnixMilli(ms)
+			}
+		}
+		if err := storage.AddScrobble(parts[1], parts[0], playedAt.Format("2006-01-02 15:04:05")); err != nil {
+			subsonicFail(c, subsonicErrGeneric, "记录播放失败")
+			return
+		}
+	}
+
+	writeSubsonic(c, newSubsonicResponse())
+}
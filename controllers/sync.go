@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"yinyue/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// syncMutex 同一时间只同步一个歌单，避免手动同步与定时同步交错写入
+var syncMutex sync.Mutex
+
+// diffPlaylist 比较同步前后的歌曲列表
+// 移动的歌曲按最长递增子序列计算：保持相对顺序的最多歌曲视为未移动，其余视为移动
+func diffPlaylist(oldSongs, newSongs []storage.PlaylistSong) storage.PlaylistDiff {
+	diff := storage.PlaylistDiff{
+		Added:   []storage.PlaylistSong{},
+		Removed: []storage.PlaylistSong{},
+		Moved:   []storage.SongMove{},
+	}
+
+	oldIndex := make(map[storage.SongRef]int, len(oldSongs))
+	for i, s := range oldSongs {
+		oldIndex[storage.SongRef{ID: s.ID, Source: s.Source}] = i
+	}
+	newIndex := make(map[storage.SongRef]int, len(newSongs))
+	for i, s := range newSongs {
+		newIndex[storage.SongRef{ID: s.ID, Source: s.Source}] = i
+	}
+
+	for _, s := range oldSongs {
+		if _, ok := newIndex[storage.SongRef{ID: s.ID, Source: s.Source}]; !ok {
+			diff.Removed = append(diff.Removed, s)
+		}
+	}
+
+	// 两边都有的歌曲，按新顺序排列它们的旧位置
+	var kept []int
+	for i, s := range newSongs {
+		if _, ok := oldIndex[storage.SongRef{ID: s.ID, Source: s.Source}]; ok {
+			kept = append(kept, i)
+		} else {
+			diff.Added = append(diff.Added, s)
+		}
+	}
+	oldPositions := make([]int, len(kept))
+	for i, n := range kept {
+		s := newSongs[n]
+		oldPositions[i] = oldIndex[storage.SongRef{ID: s.ID, Source: s.Source}]
+	}
+
+	stay := longestIncreasing(oldPositions)
+	for i, n := range kept {
+		if stay[i] {
+			continue
+		}
+		s := newSongs[n]
+		diff.Moved = append(diff.Moved, storage.SongMove{
+			ID:     s.ID,
+			Source: s.Source,
+			Name:   s.Name,
+			Artist: s.Artist,
+			From:   oldPositions[i],
+			To:     n,
+		})
+	}
+	return diff
+}
+
+// longestIncreasing 标记属于最长递增子序列的元素
+func longestIncreasing(seq []int) []bool {
+	// tails[k] 为长度 k+1 的递增子序列末尾元素的下标
+	tails := []int{}
+	prev := make([]int, len(seq))
+	for i, v := range seq {
+		k := sort.Search(len(tails), func(j int) bool { return seq[tails[j]] >= v })
+		if k > 0 {
+			prev[i] = tails[k-1]
+		} else {
+			prev[i] = -1
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+
+	in := make([]bool, len(seq))
+	if len(tails) == 0 {
+		return in
+	}
+	for i := tails[len(tails)-1]; i >= 0; i = prev[i] {
+		in[i] = true
+	}
+	return in
+}
+
+// syncPlaylist 从上游重新获取歌单，与本地比较后保存并记录同步结果
+// downloadBr 不为空时，新增的歌曲会以该音质加入下载队列
+func syncPlaylist(source, id, trigger, downloadBr string) (storage.PlaylistSync, error) {
+	syncMutex.Lock()
+	defer syncMutex.Unlock()
+
+	record := storage.PlaylistSync{
+		PlaylistID:     id,
+		PlaylistSource: source,
+		Time:           time.Now().Format("2006-01-02 15:04:05"),
+		Trigger:        trigger,
+	}
+
+	stored, ok := storage.GetPlaylist(id, source)
+	if !ok {
+		return record, storage.ErrPlaylistNotFound
+	}
+
+	// 同步需要最新的歌单，不使用缓存
+	fetched, _, err := fetchPlaylist(source, id, true)
+	if err != nil {
+		record.Error = err.Error()
+		record.ID, _ = storage.AddPlaylistSync(record)
+		return record, err
+	}
+	playlist := storagePlaylist(fetched)
+
+	record.Diff = diffPlaylist(stored.Songs, playlist.Songs)
+	record.Added = len(record.Diff.Added)
+	record.Removed = len(record.Diff.Removed)
+	record.Moved = len(record.Diff.Moved)
+
+	// 上游信息为空时保留原有名称
+	if playlist.Name == "" {
+		playlist.Name = stored.Name
+	}
+	if playlist.Author == "" {
+		playlist.Author = stored.Author
+	}
+	playlist.Description = stored.Description
+	playlist.Cover = stored.Cover
+
+	if err := storage.AddPlaylist(playlist); err != nil {
+		record.Error = "保存歌单失败"
+		record.ID, _ = storage.AddPlaylistSync(record)
+		return record, errors.New(record.Error)
+	}
+	playlistChanged(source, id)
+
+	if downloadBr != "" {
+		for _, song := range record.Diff.Added {
+			if _, status := enqueueDownload(song.Source, song.ID, song.Name, song.Artist, song.Album, song.Duration, downloadBr); status.created() {
+				record.Queued++
+			}
+		}
+	}
+
+	record.ID, _ = storage.AddPlaylistSync(record)
+	return record, nil
+}
+
+// SyncPlaylist 重新同步已导入的歌单，返回新增、移除和移动的歌曲
+func SyncPlaylist(c *gin.Context) {
+	source := c.Param("source")
+	id := c.Param("id")
+	if source == storage.LocalSource {
+		c.JSON(400, gin.H{"code": 400, "message": "本地歌单无需同步"})
+		return
+	}
+
+	// 已订阅且开启自动下载的歌单，手动同步时同样下载新增歌曲
+	var downloadBr string
+	if sub, ok := storage.GetSubscription(id, source); ok && sub.AutoDownload {
+		downloadBr = preferredQuality(sub.Quality)
+	}
+
+	record, err := syncPlaylist(source, id, "manual", downloadBr)
+	if err != nil {
+		if errors.Is(err, storage.ErrPlaylistNotFound) {
+			c.JSON(404, gin.H{"code": 404, "message": "歌单不存在"})
+			return
+		}
+		c.JSON(500, gin.H{"code": 500, "message": "同步失败: " + err.Error(), "data": record})
+		return
+	}
+
+	c.JSON(200, gin.H{"code": 200, "message": "同步完成", "data": record})
+}
+
+// GetPlaylistSyncs 获取歌单的同步记录
+func GetPlaylistSyncs(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 {
+		c.JSON(400, gin.H{"code": 400, "message": "参数错误"})
+		return
+	}
+
+	syncs := storage.GetPlaylistSyncs(c.Param("id"), c.Param("source"), limit)
+	c.JSON(200, gin.H{"code": 200, "data": syncs})
+}
+
+// GetSyncLog 获取所有歌单的同步日志
+func GetSyncLog(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		c.JSON(400, gin.H{"code": 400, "message": "参数错误"})
+		return
+	}
+
+	c.JSON(200, gin.H{"code": 200, "data": storage.GetSyncLog(limit)})
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"yinyue/storage"
+)
+
+// playlistSongs 按 "source:id" 或 "id"（默认 qq）构造歌曲列表
+func playlistSongs(refs ...string) []storage.PlaylistSong {
+	list := make([]storage.PlaylistSong, 0, len(refs))
+	for _, ref := range refs {
+		source, id, ok := strings.Cut(ref, ":")
+		if !ok {
+			source, id = "qq", ref
+		}
+		list = append(list, storage.PlaylistSong{ID: id, Source: source, Name: id})
+	}
+	return list
+}
+
+func songIDs(list []storage.PlaylistSong) []string {
+	ids := []string{}
+	for _, s := range list {
+		ids = append(ids, s.Source+":"+s.ID)
+	}
+	return ids
+}
+
+func TestDiffPlaylist(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new []storage.PlaylistSong
+		added    []string
+		removed  []string
+		moved    []storage.SongMove
+	}{
+		{
+			name: "无变化",
+			old:  playlistSongs("a", "b", "c"),
+			new:  playlistSongs("a", "b", "c"),
+		},
+		{
+			name:  "空歌单全部为新增",
+			old:   playlistSongs(),
+			new:   playlistSongs("a", "b"),
+			added: []string{"qq:a", "qq:b"},
+		},
+		{
+			name:    "新增和移除不算移动",
+			old:     playlistSongs("a", "b", "c"),
+			new:     playlistSongs("a", "c", "d"),
+			added:   []string{"qq:d"},
+			removed: []string{"qq:b"},
+		},
+		{
+			name:  "末尾移到开头只移动一首",
+			old:   playlistSongs("a", "b", "c", "d"),
+			new:   playlistSongs("d", "a", "b", "c"),
+			moved: []storage.SongMove{{ID: "d", Source: "qq", Name: "d", From: 3, To: 0}},
+		},
+		{
+			name:  "相邻交换",
+			old:   playlistSongs("a", "b", "c"),
+			new:   playlistSongs("b", "a", "c"),
+			moved: []storage.SongMove{{ID: "b", Source: "qq", Name: "b", From: 1, To: 0}},
+		},
+		{
+			name:    "同ID不同来源视为不同歌曲",
+			old:     playlistSongs("qq:1"),
+			new:     playlistSongs("netease:1"),
+			added:   []string{"netease:1"},
+			removed: []string{"qq:1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := diffPlaylist(tt.old, tt.new)
+			if got, want := songIDs(diff.Added), orEmpty(tt.added); !reflect.DeepEqual(got, want) {
+				t.Errorf("added = %v, want %v", got, want)
+			}
+			if got, want := songIDs(diff.Removed), orEmpty(tt.removed); !reflect.DeepEqual(got, want) {
+				t.Errorf("removed = %v, want %v", got, want)
+			}
+			want := tt.moved
+			if want == nil {
+				want = []storage.SongMove{}
+			}
+			if !reflect.DeepEqual(diff.Moved, want) {
+				t.Errorf("moved = %+v, want %+v", diff.Moved, want)
+			}
+		})
+	}
+}
+
+func orEmpty(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+func TestLongestIncreasing(t *testing.T) {
+	tests := []struct {
+		seq  []int
+		want []bool
+	}{
+		{nil, []bool{}},
+		{[]int{0, 1, 2}, []bool{true, true, true}},
+		{[]int{2, 1, 0}, []bool{false, false, true}},
+		{[]int{3, 0, 1, 2}, []bool{false, true, true, true}},
+		{[]int{0, 4, 1, 2, 3}, []bool{true, false, true, true, true}},
+	}
+
+	for _, tt := range tests {
+		if got := longestIncreasing(tt.seq); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("longestIncreasing(%v) = %v, want %v", tt.seq, got, tt.want)
+		}
+	}
+}
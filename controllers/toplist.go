@@ -0,0 +1,328 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"yinyue/models"
+	"yinyue/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultKeepTop 排行榜订阅默认下载的前 N 首
+const defaultKeepTop = 10
+
+// ToplistSyncResult 排行榜同步结果
+type ToplistSyncResult struct {
+	SnapshotID int64                 `json:"snapshotId"`
+	Time       string                `json:"time"`
+	Total      int                   `json:"total"`
+	Queued     int                   `json:"queued"`
+	Top        []storage.ToplistSong `json:"top"`
+	Playlist   string                `json:"playlist,omitempty"` // 本地镜像歌单ID
+}
+
+// fetchToplist 从上游获取排行榜歌曲，按排名排列
+func fetchToplist(source, id string) ([]storage.ToplistSong, error) {
+	songs, _, err := fetchToplistSongs(source, id, true)
+	if err != nil {
+		return nil, err
+	}
+	return rankedSongs(songs), nil
+}
+
+// fetchToplistSongs 从上游获取排行榜歌曲并校验响应结构，fresh 为 true 时不使用缓存
+func fetchToplistSongs(source, id string, fresh bool) ([]models.Song, cacheResult, error) {
+	params := url.Values{}
+	params.Set("source", source)
+	params.Set("type", "toplist")
+	params.Set("id", id)
+
+	var data struct {
+		List *[]upstreamSong `json:"list"`
+	}
+	cache, err := fetchUpstream(upstreamClient, params, fresh, &data)
+	if err != nil {
+		return nil, cache, err
+	}
+	if data.List == nil {
+		return nil, cache, missingField("toplist", source, "list")
+	}
+	return upstreamSongs("toplist", source, *data.List), cache, nil
+}
+
+// rankedSongs 按顺序为排行榜歌曲编排名
+func rankedSongs(songs []models.Song) []storage.ToplistSong {
+	ranked := make([]storage.ToplistSong, len(songs))
+	for i, s := range songs {
+		ranked[i] = storage.ToplistSong{
+			Rank:     i + 1,
+			ID:       s.ID,
+			Source:   s.Source,
+			Name:     s.Name,
+			Artist:   s.Artist,
+			Album:    s.Album,
+			Duration: s.Duration,
+		}
+	}
+	return ranked
+}
+
+// fetchToplists 从上游获取某个音源的排行榜列表
+func fetchToplists(source string) ([]models.Toplist, cacheResult, error) {
+	params := url.Values{}
+	params.Set("source", source)
+	params.Set("type", "toplists")
+
+	var data struct {
+		List *[]upstreamToplist `json:"list"`
+	}
+	cache, err := fetchUpstream(upstreamClient, params, false, &data)
+	if err != nil {
+		return nil, cache, err
+	}
+	if data.List == nil {
+		return nil, cache, missingField("toplists", source, "list")
+	}
+
+	toplists := make([]models.Toplist, 0, len(*data.List))
+	dropped := 0
+	for _, t := range *data.List {
+		if t.ID == "" || t.Name == "" {
+			dropped++
+			continue
+		}
+		toplists = append(toplists, models.Toplist{
+			ID:              string(t.ID),
+			Source:          source,
+			Name:            t.Name,
+			UpdateFrequency: t.UpdateFrequency,
+		})
+	}
+	if dropped > 0 {
+		log.Printf("上游数据格式异常 [toplists/%s]: %d 个排行榜缺少 id 或 name，已忽略", source, dropped)
+	}
+	return toplists, cache, nil
+}
+
+// saveToplistSnapshot 保存排行榜快照，与上一次快照相同时不重复保存，返回最新快照ID
+func saveToplistSnapshot(source, id, snapTime string, songs []storage.ToplistSong) (int64, error) {
+	if last, ok := storage.GetLatestToplistSnapshot(source, id); ok && sameChart(last.Songs, songs) {
+		return last.ID, nil
+	}
+	return storage.AddToplistSnapshot(storage.ToplistSnapshot{
+		Source:    source,
+		ToplistID: id,
+		Time:      snapTime,
+		Songs:     songs,
+	})
+}
+
+// sameChart 判断两次榜单内容和排名是否一致
+func sameChart(a, b []storage.ToplistSong) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ID != b[i].ID || a[i].Source != b[i].Source {
+			return false
+		}
+	}
+	return true
+}
+
+// fetchToplistName 从排行榜列表中查找榜单名称
+func fetchToplistName(source, id string) string {
+	toplists, _, err := fetchToplists(source)
+	if err != nil {
+		return ""
+	}
+	for _, t := range toplists {
+		if t.ID == id {
+			return t.Name
+		}
+	}
+	return ""
+}
+
+// mirrorPlaylistID 排行榜镜像歌单的本地ID
+func mirrorPlaylistID(source, id string) string {
+	return "toplist-" + source + "-" + id
+}
+
+// syncToplist 保存排行榜快照，下载前 N 首中未下载的歌曲，并按需更新镜像歌单
+func syncToplist(sub storage.ToplistSubscription) (ToplistSyncResult, error) {
+	syncMutex.Lock()
+	defer syncMutex.Unlock()
+
+	result := ToplistSyncResult{Time: time.Now().Format("2006-01-02 15:04:05")}
+
+	songs, err := fetchToplist(sub.Source, sub.ToplistID)
+	if err != nil {
+		storage.SetToplistSubscriptionSynced(sub.Source, sub.ToplistID, result.Time, err.Error())
+		return result, err
+	}
+	result.Total = len(songs)
+
+	result.SnapshotID, err = saveToplistSnapshot(sub.Source, sub.ToplistID, result.Time, songs)
+	if err != nil {
+		storage.SetToplistSubscriptionSynced(sub.Source, sub.ToplistID, result.Time, "保存快照失败")
+		return result, errors.New("保存快照失败")
+	}
+
+	top := songs
+	if len(top) > sub.KeepTop {
+		top = top[:sub.KeepTop]
+	}
+	result.Top = top
+
+	br := preferredQuality(sub.Quality)
+	for _, s := range top {
+		if _, status := enqueueDownload(s.Source, s.ID, s.Name, s.Artist, s.Album, s.Duration, br); status.created() {
+			result.Queued++
+		}
+	}
+
+	if sub.Mirror && sub.KeepTop > 0 {
+		playlist := storage.Playlist{
+			ID:     mirrorPlaylistID(sub.Source, sub.ToplistID),
+			Source: storage.LocalSource,
+			Name:   sub.Name,
+			Author: "排行榜",
+			Songs:  make([]storage.PlaylistSong, len(top)),
+		}
+		if existing, ok := storage.GetPlaylist(playlist.ID, playlist.Source); ok {
+			playlist.Description = existing.Description
+			playlist.Cover = existing.Cover
+		}
+		for i, s := range top {
+			playlist.Songs[i] = storage.PlaylistSong{
+				ID:       s.ID,
+				Source:   s.Source,
+				Name:     s.Name,
+				Artist:   s.Artist,
+				Album:    s.Album,
+				Duration: s.Duration,
+			}
+		}
+		if err := storage.AddPlaylist(playlist); err != nil {
+			storage.SetToplistSubscriptionSynced(sub.Source, sub.ToplistID, result.Time, "保存镜像歌单失败")
+			return result, errors.New("保存镜像歌单失败")
+		}
+		playlistChanged(playlist.Source, playlist.ID)
+		result.Playlist = playlist.ID
+	}
+
+	storage.SetToplistSubscriptionSynced(sub.Source, sub.ToplistID, result.Time, "")
+	return result, nil
+}
+
+// GetToplistSubscriptions 获取排行榜订阅列表
+func GetToplistSubscriptions(c *gin.Context) {
+	c.JSON(200, gin.H{"code": 200, "data": storage.GetToplistSubscriptions()})
+}
+
+// SetToplistSubscription 订阅排行榜或修改订阅设置
+func SetToplistSubscription(c *gin.Context) {
+	source := c.Param("source")
+	id := c.Param("id")
+
+	var req struct {
+		KeepTop  *int    `json:"keepTop"`
+		Interval *int    `json:"interval"`
+		Quality  *string `json:"quality"`
+		Mirror   *bool   `json:"mirror"`
+		Enabled  *bool   `json:"enabled"`
+		Name     *string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 400, "message": "参数错误"})
+		return
+	}
+
+	sub, ok := storage.GetToplistSubscription(source, id)
+	if !ok {
+		sub = storage.ToplistSubscription{
+			Source:    source,
+			ToplistID: id,
+			KeepTop:   defaultKeepTop,
+			Interval:  defaultSubscriptionInterval,
+			Enabled:   true,
+		}
+	}
+	if req.KeepTop != nil {
+		sub.KeepTop = *req.KeepTop
+	}
+	if req.Interval != nil {
+		sub.Interval = *req.Interval
+	}
+	if req.Quality != nil {
+		sub.Quality = *req.Quality
+	}
+	if req.Mirror != nil {
+		sub.Mirror = *req.Mirror
+	}
+	if req.Enabled != nil {
+		sub.Enabled = *req.Enabled
+	}
+	if req.Name != nil {
+		sub.Name = strings.TrimSpace(*req.Name)
+	}
+
+	if sub.KeepTop < 0 {
+		c.JSON(400, gin.H{"code": 400, "message": "keepTop 不能小于0"})
+		return
+	}
+	if sub.Interval < minSubscriptionInterval {
+		c.JSON(400, gin.H{"code": 400, "message": "同步间隔不能小于10分钟"})
+		return
+	}
+	if _, ok := qualityRank[sub.Quality]; sub.Quality != "" && !ok {
+		c.JSON(400, gin.H{"code": 400, "message": "音质参数错误"})
+		return
+	}
+	if sub.Name == "" {
+		sub.Name = fetchToplistName(source, id)
+	}
+	if sub.Name == "" {
+		sub.Name = fmt.Sprintf("排行榜 %s", id)
+	}
+
+	if err := storage.SetToplistSubscription(sub); err != nil {
+		c.JSON(500, gin.H{"code": 500, "message": "保存订阅失败"})
+		return
+	}
+
+	sub, _ = storage.GetToplistSubscription(source, id)
+	c.JSON(200, gin.H{"code": 200, "message": "订阅已保存", "data": sub})
+}
+
+// DeleteToplistSubscription 取消排行榜订阅，已生成的镜像歌单保留
+func DeleteToplistSubscription(c *gin.Context) {
+	if err := storage.DeleteToplistSubscription(c.Param("source"), c.Param("id")); err != nil {
+		c.JSON(500, gin.H{"code": 500, "message": "取消订阅失败"})
+		return
+	}
+	c.JSON(200, gin.H{"code": 200, "message": "已取消订阅"})
+}
+
+// SyncToplist 立即同步已订阅的排行榜
+func SyncToplist(c *gin.Context) {
+	sub, ok := storage.GetToplistSubscription(c.Param("source"), c.Param("id"))
+	if !ok {
+		c.JSON(404, gin.H{"code": 404, "message": "未订阅该排行榜"})
+		return
+	}
+
+	result, err := syncToplist(sub)
+	if err != nil {
+		c.JSON(500, gin.H{"code": 500, "message": "同步失败: " + err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"code": 200, "message": "同步完成", "data": result})
+}
@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"sort"
+	"strconv"
+
+	"yinyue/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ToplistMover 排名变化的歌曲
+type ToplistMover struct {
+	storage.ToplistSong
+	PrevRank int `json:"prevRank"`
+	Change   int `json:"change"` // 正数为上升
+}
+
+// ToplistChanges 最近两次快照之间的变化
+type ToplistChanges struct {
+	From       *storage.ToplistSnapshotInfo `json:"from"`
+	To         *storage.ToplistSnapshotInfo `json:"to"`
+	NewEntries []storage.ToplistSong        `json:"newEntries"`
+	Dropped    []storage.ToplistSong        `json:"dropped"`
+	Risers     []ToplistMover               `json:"risers"`
+	Fallers    []ToplistMover               `json:"fallers"`
+}
+
+// compareSnapshots 比较两次快照，找出新上榜、落榜以及排名变化最大的歌曲
+func compareSnapshots(prev, cur []storage.ToplistSong, top int) ToplistChanges {
+	changes := ToplistChanges{
+		NewEntries: []storage.ToplistSong{},
+		Dropped:    []storage.ToplistSong{},
+		Risers:     []ToplistMover{},
+		Fallers:    []ToplistMover{},
+	}
+
+	prevRank := make(map[storage.SongRef]int, len(prev))
+	for _, s := range prev {
+		prevRank[storage.SongRef{ID: s.ID, Source: s.Source}] = s.Rank
+	}
+	curRank := make(map[storage.SongRef]int, len(cur))
+	for _, s := range cur {
+		curRank[storage.SongRef{ID: s.ID, Source: s.Source}] = s.Rank
+	}
+
+	for _, s := range cur {
+		rank, ok := prevRank[storage.SongRef{ID: s.ID, Source: s.Source}]
+		if !ok {
+			changes.NewEntries = append(changes.NewEntries, s)
+			continue
+		}
+		mover := ToplistMover{ToplistSong: s, PrevRank: rank, Change: rank - s.Rank}
+		if mover.Change > 0 {
+			changes.Risers = append(changes.Risers, mover)
+		} else if mover.Change < 0 {
+			changes.Fallers = append(changes.Fallers, mover)
+		}
+	}
+	for _, s := range prev {
+		if _, ok := curRank[storage.SongRef{ID: s.ID, Source: s.Source}]; !ok {
+			changes.Dropped = append(changes.Dropped, s)
+		}
+	}
+
+	sort.SliceStable(changes.Risers, func(i, j int) bool {
+		return changes.Risers[i].Change > changes.Risers[j].Change
+	})
+	sort.SliceStable(changes.Fallers, func(i, j int) bool {
+		return changes.Fallers[i].Change < changes.Fallers[j].Change
+	})
+	if len(changes.Risers) > top {
+		changes.Risers = changes.Risers[:top]
+	}
+	if len(changes.Fallers) > top {
+		changes.Fallers = changes.Fallers[:top]
+	}
+	return changes
+}
+
+// snapshotInfo 生成快照概要
+func snapshotInfo(snap storage.ToplistSnapshot) *storage.ToplistSnapshotInfo {
+	return &storage.ToplistSnapshotInfo{ID: snap.ID, Time: snap.Time, Count: len(snap.Songs)}
+}
+
+// GetToplistSnapshots 获取排行榜快照列表
+func GetToplistSnapshots(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "30"))
+	if err != nil || limit <= 0 {
+		c.JSON(400, gin.H{"code": 400, "message": "参数错误"})
+		return
+	}
+
+	snapshots := storage.GetToplistSnapshots(c.Param("source"), c.Param("id"), limit)
+	c.JSON(200, gin.H{"code": 200, "data": snapshots})
+}
+
+// GetToplistRankHistory 获取歌曲在排行榜中的排名历史
+func GetToplistRankHistory(c *gin.Context) {
+	source := c.Param("source")
+	songID := c.Query("song")
+	songSource := c.DefaultQuery("songSource", source)
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "30"))
+	if songID == "" || err != nil || limit <= 0 {
+		c.JSON(400, gin.H{"code": 400, "message": "参数错误"})
+		return
+	}
+
+	history := storage.GetSongRankHistory(source, c.Param("id"), songSource, songID, limit)
+	c.JSON(200, gin.H{"code": 200, "data": history})
+}
+
+// GetToplistChanges 获取最近一次快照相对上一次的新上榜和排名变化
+func GetToplistChanges(c *gin.Context) {
+	top, err := strconv.Atoi(c.DefaultQuery("top", "10"))
+	if err != nil || top <= 0 {
+		c.JSON(400, gin.H{"code": 400, "message": "参数错误"})
+		return
+	}
+
+	snapshots := storage.GetRecentToplistSnapshots(c.Param("source"), c.Param("id"), 2)
+	if len(snapshots) == 0 {
+		c.JSON(404, gin.H{"code": 404, "message": "暂无快照"})
+		return
+	}
+
+	cur := snapshots[0]
+	var prev []storage.ToplistSong
+	if len(snapshots) > 1 {
+		prev = snapshots[1].Songs
+	}
+
+	changes := compareSnapshots(prev, cur.Songs, top)
+	changes.To = snapshotInfo(cur)
+	if len(snapshots) > 1 {
+		changes.From = snapshotInfo(snapshots[1])
+	}
+	c.JSON(200, gin.H{"code": 200, "data": changes})
+}
@@ -0,0 +1,296 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// qualityRank 音质等级，数值越大音质越好
+var qualityRank = map[string]int{
+	"128k":      1,
+	"320k":      2,
+	"flac":      3,
+	"flac24bit": 4,
+}
+
+// songQuality 获取歌曲音质，旧数据没有记录音质时根据扩展名推断
+func songQuality(song DownloadedSong) string {
+	if song.Quality != "" {
+		return song.Quality
+	}
+	if strings.EqualFold(filepath.Ext(song.Path), ".flac") {
+		return "flac"
+	}
+	return ""
+}
+
+// UpgradeItem 音质升级检查结果
+type UpgradeItem struct {
+	ID             string `json:"id"`
+	Source         string `json:"source"`
+	Name           string `json:"name"`
+	Artist         string `json:"artist"`
+	CurrentQuality string `json:"currentQuality"`
+	CurrentSize    int64  `json:"currentSize"`
+	NewSize        int64  `json:"newSize"`
+	Action         string `json:"action"` // upgrade, skip, upgraded, failed
+	Reason         string `json:"reason,omitempty"`
+}
+
+// UpgradeJob 音质升级任务
+type UpgradeJob struct {
+	Quality   string        `json:"quality"`
+	DryRun    bool          `json:"dryRun"`
+	Status    string        `json:"status"` // running, done
+	Total     int           `json:"total"`
+	Checked   int           `json:"checked"`
+	Upgraded  int           `json:"upgraded"`
+	Failed    int           `json:"failed"`
+	Items     []UpgradeItem `json:"items"`
+	StartTime string        `json:"startTime"`
+	EndTime   string        `json:"endTime,omitempty"`
+}
+
+var (
+	upgradeJob   *UpgradeJob
+	upgradeMutex sync.RWMutex
+)
+
+// StartLibraryUpgrade 启动音质升级任务（默认仅预演）
+func StartLibraryUpgrade(c *gin.Context) {
+	var req struct {
+		Quality string `json:"quality"`
+		DryRun  *bool  `json:"dryRun"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 400, "message": "参数错误"})
+		return
+	}
+	if _, ok := qualityRank[req.Quality]; !ok {
+		c.JSON(400, gin.H{"code": 400, "message": "不支持的音质"})
+		return
+	}
+	dryRun := true
+	if req.DryRun != nil {
+		dryRun = *req.DryRun
+	}
+
+	upgradeMutex.Lock()
+	if upgradeJob != nil && upgradeJob.Status == "running" {
+		upgradeMutex.Unlock()
+		c.JSON(409, gin.H{"code": 409, "message": "已有升级任务在运行"})
+		return
+	}
+
+	// 挑选低于目标音质的歌曲
+	libMutex.RLock()
+	var candidates []DownloadedSong
+	for _, song := range downloadedSongs {
+		if qualityRank[songQuality(song)] < qualityRank[req.Quality] {
+			candidates = append(candidates, song)
+		}
+	}
+	libMutex.RUnlock()
+
+	job := &UpgradeJob{
+		Quality:   req.Quality,
+		DryRun:    dryRun,
+		Status:    "running",
+		Total:     len(candidates),
+		Items:     make([]UpgradeItem, 0, len(candidates)),
+		StartTime: time.Now().Format("2006-01-02 15:04:05"),
+	}
+	upgradeJob = job
+	upgradeMutex.Unlock()
+
+	go runUpgrade(job, candidates)
+
+	c.JSON(200, gin.H{"code": 200, "message": "升级任务已启动", "data": job})
+}
+
+// GetLibraryUpgrade 获取音质升级任务状态和报告
+func GetLibraryUpgrade(c *gin.Context) {
+	upgradeMutex.RLock()
+	defer upgradeMutex.RUnlock()
+
+	c.JSON(200, gin.H{"code": 200, "data": upgradeJob})
+}
+
+// runUpgrade 逐首检查并升级音质
+func runUpgrade(job *UpgradeJob, songs []DownloadedSong) {
+	for _, song := range songs {
+		item := checkUpgrade(song, job.Quality)
+
+		if item.Action == "upgrade" && !job.DryRun {
+			if err := applyUpgrade(song, job.Quality); err != nil {
+				log.Printf("升级音质失败 %s_%s: %v", song.Source, song.ID, err)
+				item.Action = "failed"
+				item.Reason = err.Error()
+			} else {
+				item.Action = "upgraded"
+			}
+		}
+
+		upgradeMutex.Lock()
+		job.Checked++
+		switch item.Action {
+		case "upgraded":
+			job.Upgraded++
+		case "failed":
+			job.Failed++
+		}
+		job.Items = append(job.Items, item)
+		upgradeMutex.Unlock()
+	}
+
+	upgradeMutex.Lock()
+	job.Status = "done"
+	job.EndTime = time.Now().Format("2006-01-02 15:04:05")
+	upgradeMutex.Unlock()
+}
+
+// checkUpgrade 查询上游是否有更高音质的文件
+func checkUpgrade(song DownloadedSong, quality string) UpgradeItem {
+	item := UpgradeItem{
+		ID:             song.ID,
+		Source:         song.Source,
+		Name:           song.Name,
+		Artist:         song.Artist,
+		CurrentQuality: songQuality(song),
+		Action:         "skip",
+	}
+
+	if info, err := os.Stat(song.Path); err == nil {
+		item.CurrentSize = info.Size()
+	}
+
+	source, id := song.fileRef()
+	location, sourceSwitch, err := resolveMusicURL(source, id, quality)
+	if err != nil {
+		item.Reason = err.Error()
+		return item
+	}
+	if sourceSwitch != "" {
+		item.Reason = "上游已切换音源"
+		return item
+	}
+
+	resp, err := http.Head(location)
+	if err != nil {
+		item.Reason = "请求文件信息失败"
+		return item
+	}
+	resp.Body.Close()
+	item.NewSize = resp.ContentLength
+
+	// 文件明显变大才视为音质提升
+	if item.NewSize <= 0 || item.NewSize <= item.CurrentSize*11/10 {
+		item.Reason = "上游没有更高音质"
+		return item
+	}
+
+	item.Action = "upgrade"
+	return item
+}
+
+// resolveMusicURL 解析歌曲的真实播放地址（不跟随跳转）
+func resolveMusicURL(source, id, br string) (location, sourceSwitch string, err error) {
+	params := url.Values{}
+	params.Set("source", source)
+	params.Set("type", "url")
+	params.Set("id", id)
+	params.Set("br", br)
+
+	reqURL := baseURL + "/api/?" + params.Encode()
+
+	client := &http.Client{
+		Timeout: upstreamTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get(reqURL)
+	if err != nil {
+		if os.IsTimeout(err) {
+			return "", "", errUpstreamTimeout
+		}
+		return "", "", errUpstreamRequest
+	}
+	defer resp.Body.Close()
+
+	location = resp.Header.Get("Location")
+	if resp.StatusCode != 302 || location == "" {
+		return "", "", &upstreamError{
+			Status:  resp.StatusCode,
+			Code:    resp.StatusCode,
+			Message: "获取播放地址失败",
+			Header:  resp.Header,
+		}
+	}
+	return location, resp.Header.Get("X-Source-Switch"), nil
+}
+
+// applyUpgrade 通过下载子系统获取新文件，原子替换旧文件并更新音乐库
+func applyUpgrade(song DownloadedSong, quality string) error {
+	taskID := "upgrade_" + song.Source + "_" + song.ID
+	task := &DownloadTask{
+		ID:     taskID,
+		Name:   song.Name,
+		Artist: song.Artist,
+		Source: song.Source,
+		Status: "downloading",
+	}
+	taskMutex.Lock()
+	downloadTasks[taskID] = task
+	taskMutex.Unlock()
+
+	ext := ".mp3"
+	if quality == "flac" || quality == "flac24bit" {
+		ext = ".flac"
+	}
+	dir := filepath.Dir(song.Path)
+	filename := strings.TrimSuffix(filepath.Base(song.Path), filepath.Ext(song.Path)) + ext
+	filePath := filepath.Join(dir, filename)
+
+	// fetchToFile 下载完成后才会 rename 到目标路径，旧文件在此之前保持可用
+	source, id := song.fileRef()
+	if err := fetchToFile(task, source, id, quality, filePath); err != nil {
+		task.fail(err)
+		return err
+	}
+
+	taskMutex.Lock()
+	task.Status = "success"
+	task.Progress = 100
+	taskMutex.Unlock()
+
+	if filePath != song.Path {
+		os.Remove(song.Path)
+	}
+
+	libMutex.Lock()
+	for i := range downloadedSongs {
+		if downloadedSongs[i].ID == song.ID && downloadedSongs[i].Source == song.Source {
+			downloadedSongs[i].Filename = filename
+			downloadedSongs[i].Path = filePath
+			downloadedSongs[i].Quality = quality
+			if info, err := os.Stat(filePath); err == nil {
+				downloadedSongs[i].Size = info.Size()
+			}
+			break
+		}
+	}
+	syncLibraryToStorage()
+	libMutex.Unlock()
+
+	return nil
+}
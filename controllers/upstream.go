@@ -0,0 +1,245 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"yinyue/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// upstreamTimeout 请求上游的超时时间
+const upstreamTimeout = 15 * time.Second
+
+// upstreamClient 请求上游 API 使用的 HTTP 客户端
+var upstreamClient = &http.Client{Timeout: upstreamTimeout}
+
+// errUpstreamRequest 请求上游失败（网络错误）
+var errUpstreamRequest = errors.New("请求失败")
+
+// errUpstreamTimeout 请求上游超时
+var errUpstreamTimeout = errors.New("请求超时")
+
+// errSchemaDrift 上游响应结构与预期不符
+var errSchemaDrift = errors.New("上游数据格式异常")
+
+// upstreamError 上游返回了非 200 的业务码
+type upstreamError struct {
+	Status  int // HTTP 状态码
+	Code    int // 上游业务码
+	Message string
+	Header  http.Header // 响应头，用于读取 Retry-After
+}
+
+func (e *upstreamError) Error() string {
+	if e.Message != "" {
+		return "上游返回错误: " + e.Message
+	}
+	return "上游返回错误"
+}
+
+// flexID 上游有时返回数字ID，有时返回字符串ID
+type flexID string
+
+func (f *flexID) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*f = flexID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*f = flexID(n.String())
+	return nil
+}
+
+// flexSeconds 上游的时长字段，可能是秒、毫秒或 "mm:ss"，无法解析时视为未知
+type flexSeconds int
+
+func (d *flexSeconds) UnmarshalJSON(data []byte) error {
+	*d = 0
+	s := strings.Trim(string(data), `"`)
+	if m, sec, ok := strings.Cut(s, ":"); ok {
+		mi, err1 := strconv.Atoi(m)
+		si, err2 := strconv.Atoi(sec)
+		if err1 == nil && err2 == nil {
+			*d = flexSeconds(mi*60 + si)
+		}
+		return nil
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n <= 0 {
+		return nil
+	}
+	// 超过 10 小时的数值按毫秒处理
+	if n > 36000 {
+		n /= 1000
+	}
+	*d = flexSeconds(n)
+	return nil
+}
+
+// upstreamSong 上游返回的歌曲
+type upstreamSong struct {
+	ID       flexID      `json:"id"`
+	Name     string      `json:"name"`
+	Artist   string      `json:"artist"`
+	Album    string      `json:"album"`
+	Types    []string    `json:"types"`
+	Duration flexSeconds `json:"duration"`
+}
+
+// upstreamToplist 上游返回的排行榜
+type upstreamToplist struct {
+	ID              flexID `json:"id"`
+	Name            string `json:"name"`
+	UpdateFrequency string `json:"updateFrequency"`
+}
+
+// getUpstream 请求上游 API，返回 HTTP 状态码和响应体
+// 可重试的失败按请求类型的策略重试（见 retryDelay），音源熔断中直接返回 errSourceUnavailable
+// 网络错误统一为 errUpstreamRequest，超时为 errUpstreamTimeout
+func getUpstream(client *http.Client, params url.Values) (int, []byte, error) {
+	kind, source := params.Get("type"), params.Get("source")
+	if err := allowSource(source); err != nil {
+		return 0, nil, err
+	}
+
+	policy := retryPolicyFor(kind)
+	ctx, cancel := policy.context()
+	defer cancel()
+	for attempt := 1; ; attempt++ {
+		status, header, body, err := getUpstreamOnce(ctx, client, params)
+		if delay, ok := policy.retryDelay(ctx, attempt, status, header, err); ok {
+			log.Printf("请求上游失败 [%s/%s]，%v 后重试 (%d/%d): %s",
+				kind, source, delay.Round(time.Millisecond), attempt, policy.Attempts-1, attemptError(status, err))
+			time.Sleep(delay)
+			continue
+		}
+
+		recordUpstreamResult(source, status, err)
+		if err != nil {
+			if os.IsTimeout(err) {
+				return status, nil, errUpstreamTimeout
+			}
+			return status, nil, errUpstreamRequest
+		}
+		return status, body, nil
+	}
+}
+
+// getUpstreamOnce 请求一次上游 API
+func getUpstreamOnce(ctx context.Context, client *http.Client, params url.Values) (int, http.Header, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL+"/api/?"+params.Encode(), nil)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, resp.Header, body, err
+}
+
+// decodeUpstream 校验上游响应的业务码并将 data 解析到 v，结构不符时记录日志
+func decodeUpstream(kind, source string, status int, body []byte, v interface{}) error {
+	var envelope struct {
+		Code    *int            `json:"code"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil || envelope.Code == nil {
+		// 非 JSON 的错误页按上游错误处理，不算格式变化
+		if status >= 400 {
+			return &upstreamError{Status: status, Code: status}
+		}
+		logSchemaDrift(kind, source, "响应缺少 code 字段或不是 JSON", body)
+		return errSchemaDrift
+	}
+	if *envelope.Code != 200 {
+		return &upstreamError{Status: status, Code: *envelope.Code, Message: envelope.Message}
+	}
+	if len(envelope.Data) == 0 || string(envelope.Data) == "null" {
+		logSchemaDrift(kind, source, "响应缺少 data 字段", body)
+		return errSchemaDrift
+	}
+	if err := json.Unmarshal(envelope.Data, v); err != nil {
+		logSchemaDrift(kind, source, err.Error(), body)
+		return errSchemaDrift
+	}
+	return nil
+}
+
+// missingField 上游响应缺少必需的字段
+func missingField(kind, source, field string) error {
+	log.Printf("上游数据格式异常 [%s/%s]: 响应缺少 %s 字段", kind, source, field)
+	return errSchemaDrift
+}
+
+// logSchemaDrift 记录上游响应结构变化，附带响应开头便于排查
+func logSchemaDrift(kind, source, reason string, body []byte) {
+	const maxSample = 200
+	sample := body
+	if len(sample) > maxSample {
+		sample = sample[:maxSample]
+	}
+	log.Printf("上游数据格式异常 [%s/%s]: %s, 响应: %s", kind, source, reason, sample)
+}
+
+// upstreamSongs 将上游歌曲转换为统一结构，缺少ID或歌名的条目会被丢弃并记录
+func upstreamSongs(kind, source string, list []upstreamSong) []models.Song {
+	songs := make([]models.Song, 0, len(list))
+	dropped := 0
+	for _, s := range list {
+		if s.ID == "" || s.Name == "" {
+			dropped++
+			continue
+		}
+		if s.Types == nil {
+			s.Types = []string{}
+		}
+		songs = append(songs, models.Song{
+			ID:       string(s.ID),
+			Source:   source,
+			Name:     s.Name,
+			Artist:   s.Artist,
+			Album:    s.Album,
+			Types:    s.Types,
+			Duration: int(s.Duration),
+		})
+	}
+	if dropped > 0 {
+		log.Printf("上游数据格式异常 [%s/%s]: %d 首歌曲缺少 id 或 name，已忽略", kind, source, dropped)
+	}
+	return songs
+}
+
+// respondUpstreamError 将上游请求错误转换为统一响应
+func respondUpstreamError(c *gin.Context, err error) {
+	var upErr *upstreamError
+	switch {
+	case errors.As(err, &upErr):
+		c.JSON(502, models.Error(502, upErr.Error()))
+	case errors.Is(err, errSchemaDrift):
+		c.JSON(502, models.Error(502, err.Error()))
+	case errors.Is(err, errUpstreamOffline), errors.Is(err, errSourceUnavailable):
+		c.JSON(503, models.Error(503, err.Error()))
+	default:
+		c.JSON(500, models.Error(500, err.Error()))
+	}
+}
@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFlexSeconds(t *testing.T) {
+	tests := []struct {
+		json string
+		want int
+	}{
+		{`240`, 240},
+		{`"240"`, 240},
+		{`254.6`, 254},
+		{`240000`, 240},
+		{`"04:05"`, 245},
+		{`"4:xx"`, 0},
+		{`"abc"`, 0},
+		{`0`, 0},
+		{`-5`, 0},
+		{`null`, 0},
+	}
+
+	for _, tt := range tests {
+		var d flexSeconds
+		if err := json.Unmarshal([]byte(tt.json), &d); err != nil {
+			t.Errorf("Unmarshal(%s) error: %v", tt.json, err)
+			continue
+		}
+		if int(d) != tt.want {
+			t.Errorf("Unmarshal(%s) = %d, want %d", tt.json, d, tt.want)
+		}
+	}
+}
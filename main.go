@@ -69,6 +69,9 @@ func main() {
 	controllers.InitLibrary(DataDir)
 	log.Println("音乐库初始化完成")
 
+	// 启动定时任务（歌单订阅同步）
+	controllers.StartScheduler()
+
 	// 初始化路由（传入嵌入的静态文件）
 	log.Println("正在初始化路由...")
 	r := routes.SetupRouter(StaticFS, TemplatesFS)
@@ -8,7 +8,8 @@ func Cors() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, Range")
+		c.Header("Access-Control-Expose-Headers", "Content-Length, Content-Range, Accept-Ranges, ETag")
 		// 允许在 iframe 中嵌入
 		c.Header("X-Frame-Options", "ALLOWALL")
 		c.Header("Content-Security-Policy", "frame-ancestors *")
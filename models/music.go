@@ -0,0 +1,56 @@
+package models
+
+// Song 歌曲，各音源的搜索、排行榜、歌单结果统一为该结构
+type Song struct {
+	ID       string   `json:"id"`
+	Source   string   `json:"source"`
+	Name     string   `json:"name"`
+	Artist   string   `json:"artist"`
+	Album    string   `json:"album"`
+	Types    []string `json:"types"`              // 可下载的音质
+	Duration int      `json:"duration,omitempty"` // 时长（秒），上游未提供时为 0
+}
+
+// SearchResult 单个音源的搜索结果
+type SearchResult struct {
+	Keyword string `json:"keyword"`
+	Source  string `json:"source"`
+	Results []Song `json:"results"`
+}
+
+// Toplist 排行榜
+type Toplist struct {
+	ID              string `json:"id"`
+	Source          string `json:"source"`
+	Name            string `json:"name"`
+	UpdateFrequency string `json:"updateFrequency,omitempty"`
+}
+
+// ToplistList 某个音源的排行榜列表
+type ToplistList struct {
+	Source string    `json:"source"`
+	List   []Toplist `json:"list"`
+}
+
+// ToplistDetail 排行榜歌曲，按排名排列
+type ToplistDetail struct {
+	ID     string `json:"id"`
+	Source string `json:"source"`
+	List   []Song `json:"list"`
+}
+
+// Playlist 上游歌单，歌曲保持上游顺序
+type Playlist struct {
+	ID     string `json:"id"`
+	Source string `json:"source"`
+	Name   string `json:"name"`
+	Author string `json:"author"`
+	Songs  []Song `json:"songs"`
+}
+
+// MusicURL 歌曲播放地址
+type MusicURL struct {
+	URL          string `json:"url"`                    // 上游解析得到的 CDN 地址，有时效
+	ProxyURL     string `json:"proxyUrl"`               // 经服务端代理播放的地址
+	SourceSwitch string `json:"sourceSwitch,omitempty"` // 上游换源时返回的实际音源
+}
@@ -1,19 +1,25 @@
 package models
 
+// Response 接口统一响应结构，code 与 HTTP 状态码一致，成功为 200
 type Response struct {
 	Code    int         `json:"code"`
 	Message string      `json:"message"`
 	Data    interface{} `json:"data"`
+	// 上游不可用或缓存过期时返回的旧数据会标记 stale，并附带数据获取时间
+	Stale    bool   `json:"stale,omitempty"`
+	CachedAt string `json:"cachedAt,omitempty"`
 }
 
+// Success 成功响应
 func Success(data interface{}) Response {
 	return Response{
-		Code:    0,
+		Code:    200,
 		Message: "success",
 		Data:    data,
 	}
 }
 
+// Error 错误响应
 func Error(code int, msg string) Response {
 	return Response{
 		Code:    code,
@@ -41,19 +41,86 @@ func SetupRouter(staticFS, templatesFS embed.FS) *gin.Engine {
 		api.GET("/hello", controllers.Hello)
 		api.GET("/search", controllers.SearchMusic)
 		api.GET("/url", controllers.GetMusicURL)
+		api.GET("/stream", controllers.ProxyStream)
 		api.GET("/download", controllers.DownloadMusic)
 		api.GET("/downloads", controllers.GetDownloadTasks)
+		api.POST("/download/batch", controllers.StartBatchDownload)
+		api.GET("/download/batch/:id", controllers.GetBatchDownload)
+		api.GET("/download/batches", controllers.GetBatchDownloads)
 		api.GET("/library", controllers.GetLibrary)
+		api.GET("/library.m3u8", controllers.ExportLibraryM3U)
+		api.GET("/library.zip", controllers.ExportLibraryZip)
+		api.POST("/export.zip", controllers.ExportSelectionZip)
 		api.POST("/library/refresh", controllers.RefreshLibrary)
+		api.GET("/library/:source/:id/stream", controllers.StreamLibrarySong)
+		api.GET("/library/stats", controllers.GetLibraryStats)
+		api.GET("/library/upgrade", controllers.GetLibraryUpgrade)
+		api.POST("/library/upgrade", controllers.StartLibraryUpgrade)
 		api.GET("/downloaded", controllers.IsDownloaded)
+		api.GET("/health", controllers.GetUpstreamHealth)
+		api.GET("/cache", controllers.GetCacheStats)
+		api.DELETE("/cache", controllers.PurgeCache)
 		api.GET("/settings", controllers.GetSettings)
 		api.POST("/settings", controllers.UpdateSettings)
 		api.GET("/toplists", controllers.GetToplists)
 		api.GET("/toplist", controllers.GetToplistSongs)
 		api.GET("/playlists", controllers.GetPlaylists)
+		api.POST("/playlists", controllers.CreateLocalPlaylist)
 		api.GET("/playlist/import", controllers.ImportPlaylist)
+		api.POST("/playlist/import", controllers.ImportPlaylistLink)
+		api.POST("/playlist/import/file", controllers.ImportPlaylistFile)
+		api.GET("/import/jobs", controllers.GetImportJobs)
+		api.GET("/import/jobs/:id", controllers.GetImportJob)
 		api.DELETE("/playlist", controllers.DeletePlaylist)
+		api.GET("/playlist/:source/:id", controllers.GetPlaylist)
+		api.PUT("/playlist/:source/:id", controllers.UpdateLocalPlaylist)
+		api.POST("/playlist/:source/:id/songs", controllers.AddLocalPlaylistSongs)
+		api.DELETE("/playlist/:source/:id/songs", controllers.RemoveLocalPlaylistSongs)
+		api.PUT("/playlist/:source/:id/songs", controllers.ReorderPlaylistSongs)
+		api.GET("/playlist/:source/:id/status", controllers.GetPlaylistStatus)
+		api.POST("/playlist/:source/:id/sync", controllers.SyncPlaylist)
+		api.GET("/playlist/:source/:id/syncs", controllers.GetPlaylistSyncs)
+		api.PUT("/playlist/:source/:id/subscription", controllers.SetSubscription)
+		api.DELETE("/playlist/:source/:id/subscription", controllers.DeleteSubscription)
+		api.GET("/subscriptions", controllers.GetSubscriptions)
+		api.GET("/syncs", controllers.GetSyncLog)
+		api.GET("/toplist/subscriptions", controllers.GetToplistSubscriptions)
+		api.PUT("/toplist/:source/:id/subscription", controllers.SetToplistSubscription)
+		api.DELETE("/toplist/:source/:id/subscription", controllers.DeleteToplistSubscription)
+		api.POST("/toplist/:source/:id/sync", controllers.SyncToplist)
+		api.GET("/toplist/:source/:id/snapshots", controllers.GetToplistSnapshots)
+		api.GET("/toplist/:source/:id/history", controllers.GetToplistRankHistory)
+		api.GET("/toplist/:source/:id/changes", controllers.GetToplistChanges)
+	}
+
+	// Subsonic/OpenSubsonic 兼容接口（供 DSub、Symfonium、Feishin 等客户端使用）
+	rest := r.Group("/rest", controllers.SubsonicAuth())
+	{
+		subsonicRoute(rest, "ping", controllers.SubsonicPing)
+		subsonicRoute(rest, "getLicense", controllers.SubsonicGetLicense)
+		subsonicRoute(rest, "getMusicFolders", controllers.SubsonicGetMusicFolders)
+		subsonicRoute(rest, "getIndexes", controllers.SubsonicGetIndexes)
+		subsonicRoute(rest, "getMusicDirectory", controllers.SubsonicGetMusicDirectory)
+		subsonicRoute(rest, "getArtists", controllers.SubsonicGetArtists)
+		subsonicRoute(rest, "getArtist", controllers.SubsonicGetArtist)
+		subsonicRoute(rest, "getAlbum", controllers.SubsonicGetAlbum)
+		subsonicRoute(rest, "getSong", controllers.SubsonicGetSong)
+		subsonicRoute(rest, "search3", controllers.SubsonicSearch3)
+		subsonicRoute(rest, "stream", controllers.SubsonicStream)
+		subsonicRoute(rest, "download", controllers.SubsonicStream)
+		subsonicRoute(rest, "getCoverArt", controllers.SubsonicGetCoverArt)
+		subsonicRoute(rest, "getPlaylists", controllers.SubsonicGetPlaylists)
+		subsonicRoute(rest, "getPlaylist", controllers.SubsonicGetPlaylist)
+		subsonicRoute(rest, "scrobble", controllers.SubsonicScrobble)
 	}
 
 	return r
 }
+
+// subsonicRoute 注册 Subsonic 接口，同时支持 GET/POST 及 .view 后缀
+func subsonicRoute(g *gin.RouterGroup, name string, handler gin.HandlerFunc) {
+	for _, path := range []string{"/" + name, "/" + name + ".view"} {
+		g.GET(path, handler)
+		g.POST(path, handler)
+	}
+}
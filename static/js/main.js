@@ -23,8 +23,10 @@ function renderSongItem(item, index, options = {}) {
         showArtist = true,
         showAlbum = true,
         showTypes = false,
+        showSource = false,
         showDownloadBtn = true
     } = options;
+    const songSource = item.source || source;
 
     // 复选框
     const checkboxHtml = showCheckbox
@@ -37,7 +39,8 @@ function renderSongItem(item, index, options = {}) {
     if (showTypes && item.types && item.types.length > 0) {
         subtitleHtml = `<div class="song-subtitle">${item.types.join(' / ')}</div>`;
     } else if (showArtist) {
-        subtitleHtml = `<div class="song-subtitle">${item.artist || ''}</div>`;
+        const sourceLabel = showSource ? ` · ${sourceLabels[songSource] || songSource}${item.duplicate ? '（重复）' : ''}` : '';
+        subtitleHtml = `<div class="song-subtitle">${item.artist || ''}${sourceLabel}</div>`;
     }
 
     // 专辑
@@ -53,7 +56,7 @@ function renderSongItem(item, index, options = {}) {
         const artist = (item.artist || '').replace(/'/g, "\\'");
         const name = (item.name || '').replace(/'/g, "\\'");
         const album = (item.album || '').replace(/'/g, "\\'");
-        actionHtml = `<button class="download-btn" onclick="downloadSong('${source}', '${item.id}', '${name}', '${artist}', '${album}')">下载</button>`;
+        actionHtml = `<button class="download-btn" onclick="downloadSong('${songSource}', '${item.id}', '${name}', '${artist}', '${album}', ${item.duration || 0})">下载</button>`;
     }
 
     return `
@@ -279,6 +282,36 @@ function initPlaylist() {
     document.getElementById('playlist-batch-download').addEventListener('click', function() {
         batchDownload('playlist');
     });
+    document.getElementById('playlist-sync-btn').addEventListener('click', syncCurrentPlaylist);
+}
+
+// 同步当前歌单
+async function syncCurrentPlaylist() {
+    const playlist = currentPlaylistDetail;
+    if (!playlist) return;
+
+    const btn = document.getElementById('playlist-sync-btn');
+    btn.textContent = '同步中...';
+    btn.disabled = true;
+
+    try {
+        const resp = await fetch(`/api/v1/playlist/${playlist.source}/${encodeURIComponent(playlist.id)}/sync`, { method: 'POST' });
+        const data = await resp.json();
+
+        if (data.code === 200) {
+            const r = data.data;
+            toast(`同步完成：新增 ${r.added} 首，移除 ${r.removed} 首，移动 ${r.moved} 首`, 'success');
+            await loadPlaylists();
+            openPlaylist(playlist.id, playlist.source);
+        } else {
+            toast('同步失败: ' + (data.message || '未知错误'), 'error');
+        }
+    } catch (err) {
+        toast('请求失败', 'error');
+    } finally {
+        btn.textContent = '同步';
+        btn.disabled = false;
+    }
 }
 
 // 加载已导入的歌单列表
@@ -316,19 +349,26 @@ function renderPlaylists() {
 // 导入歌单
 async function importPlaylist() {
     const source = getSelectValue('playlist-source-wrapper');
-    const id = document.getElementById('playlist-id-input').value.trim();
+    const input = document.getElementById('playlist-id-input').value.trim();
 
-    if (!id) {
-        toast('请输入歌单ID', 'warning');
+    if (!input) {
+        toast('请输入歌单ID或分享链接', 'warning');
         return;
     }
 
+    // 纯数字按所选音源的歌单ID导入，其余按分享链接自动识别
+    const body = /^\d+$/.test(input) ? { source, id: input } : { link: input };
+
     const btn = document.getElementById('import-playlist-btn');
     btn.textContent = '导入中...';
     btn.disabled = true;
 
     try {
-        const resp = await fetch(`/api/v1/playlist/import?source=${source}&id=${id}`);
+        const resp = await fetch('/api/v1/playlist/import', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(body)
+        });
         const data = await resp.json();
 
         if (data.code === 200) {
@@ -357,6 +397,7 @@ function openPlaylist(id, source) {
     document.getElementById('playlist-detail').style.display = 'block';
     document.getElementById('playlist-detail-name').textContent = playlist.name;
     document.getElementById('playlist-detail-author').textContent = playlist.author;
+    document.getElementById('playlist-sync-btn').style.display = playlist.source === 'local' ? 'none' : '';
 
     renderPlaylistSongs(playlist);
 }
@@ -368,17 +409,20 @@ async function renderPlaylistSongs(playlist) {
 
     // 重置选择状态
     playlistSelectedSongs = [];
-    currentPlaylistSongs = playlist.songs.map(s => ({ ...s, source: playlist.source }));
+    currentPlaylistSongs = playlist.songs.map(s => ({ ...s, source: s.source || playlist.source }));
     document.getElementById('playlist-select-all').checked = false;
     updateSelectedCount('playlist');
 
     // 检查已下载状态
-    const ids = playlist.songs.map(s => s.id).join(',');
     let downloaded = {};
     try {
-        const resp = await fetch(`/api/v1/downloaded?source=${playlist.source}&ids=${ids}`);
+        const resp = await fetch(`/api/v1/playlist/${playlist.source}/${encodeURIComponent(playlist.id)}/status`);
         const data = await resp.json();
-        downloaded = data.data || {};
+        if (data.code === 200) {
+            data.data.songs.forEach(s => {
+                if (s.state === 'downloaded') downloaded[s.id] = true;
+            });
+        }
     } catch (e) {}
 
     list.innerHTML = renderSongList(playlist.songs, downloaded, {
@@ -391,6 +435,9 @@ async function renderPlaylistSongs(playlist) {
     });
 }
 
+// 音源显示名称
+const sourceLabels = { netease: '网易云', qq: 'QQ音乐', kuwo: '酷我' };
+
 // 搜索功能
 function initSearch() {
     const searchBtn = document.getElementById('search-btn');
@@ -419,6 +466,14 @@ async function doSearch() {
 
         if (data.code === 200 && data.data) {
             showSearchResults(data.data.results || []);
+            if (data.stale || data.data.stale) {
+                toast('上游服务不可用，显示的是缓存结果', 'warning');
+            }
+            // 聚合搜索时提示失败的音源
+            const failed = data.data.failed || [];
+            if (failed.length > 0) {
+                toast('部分音源搜索失败: ' + failed.map(s => sourceLabels[s] || s).join('、'), 'warning');
+            }
         } else {
             toast('搜索失败: ' + (data.message || '未知错误'), 'error');
         }
@@ -438,7 +493,7 @@ async function showSearchResults(results) {
 
     // 重置选择状态
     searchSelectedSongs = [];
-    currentSearchResults = results.map(r => ({ ...r, source }));
+    currentSearchResults = results.map(r => ({ ...r, source: r.source || source }));
     document.getElementById('search-select-all').checked = false;
     updateSelectedCount('search');
 
@@ -449,18 +504,23 @@ async function showSearchResults(results) {
         return;
     }
 
-    // 检查已下载状态
-    const ids = results.map(r => r.id).join(',');
+    // 检查已下载状态，聚合搜索结果自带 downloaded 标记
     let downloaded = {};
-    try {
-        const resp = await fetch(`/api/v1/downloaded?source=${source}&ids=${ids}`);
-        const data = await resp.json();
-        downloaded = data.data || {};
-    } catch (e) {}
+    if (source === 'all') {
+        results.forEach(r => { if (r.downloaded) downloaded[r.id] = true; });
+    } else {
+        const ids = results.map(r => r.id).join(',');
+        try {
+            const resp = await fetch(`/api/v1/downloaded?source=${source}&ids=${ids}`);
+            const data = await resp.json();
+            downloaded = data.data || {};
+        } catch (e) {}
+    }
 
     list.innerHTML = renderSongList(results, downloaded, {
         type: 'search',
         source: source,
+        showSource: source === 'all',
         showCheckbox: true,
         showArtist: true,
         showAlbum: true,
@@ -472,14 +532,14 @@ async function showSearchResults(results) {
 }
 
 // 下载歌曲
-async function downloadSong(source, id, name, artist, album) {
+async function downloadSong(source, id, name, artist, album, duration) {
     const br = getSelectValue('quality-select-wrapper');
     const btn = event.target;
     btn.textContent = '已加入';
     btn.disabled = true;
 
     try {
-        const params = new URLSearchParams({ source, id, name, artist, album: album || '', br });
+        const params = new URLSearchParams({ source, id, name, artist, album: album || '', duration: duration || 0, br });
         await fetch('/api/v1/download?' + params);
     } catch (err) {
         btn.textContent = '下载';
@@ -539,6 +599,13 @@ async function loadSettings() {
         const data = await resp.json();
         if (data.code === 200) {
             document.getElementById('download-dir').value = data.data.downloadDir || '';
+            document.getElementById('min-free-space').value = data.data.minFreeSpace || 0;
+            document.getElementById('max-library-size').value = data.data.maxLibrarySize || 0;
+            document.getElementById('stream-cache').checked = !!data.data.streamCache;
+            document.getElementById('auto-m3u').checked = !!data.data.autoM3U;
+            document.getElementById('cross-source').checked = !!data.data.crossSource;
+            document.getElementById('subsonic-user').value = data.data.subsonicUser || '';
+            document.getElementById('subsonic-password').placeholder = data.data.subsonicEnabled ? '已设置' : '未设置（Subsonic 接口禁用）';
             // 加载音质设置
             if (data.data.quality) {
                 setSelectValue('quality-select-wrapper', data.data.quality);
@@ -552,12 +619,23 @@ async function loadSettings() {
 async function saveSettings() {
     const downloadDir = document.getElementById('download-dir').value;
     const quality = getSelectValue('quality-select-wrapper');
+    const minFreeSpace = parseInt(document.getElementById('min-free-space').value) || 0;
+    const maxLibrarySize = parseInt(document.getElementById('max-library-size').value) || 0;
+    const streamCache = document.getElementById('stream-cache').checked;
+    const autoM3U = document.getElementById('auto-m3u').checked;
+    const crossSource = document.getElementById('cross-source').checked;
+    const subsonicUser = document.getElementById('subsonic-user').value;
+    const payload = { downloadDir, quality, minFreeSpace, maxLibrarySize, streamCache, autoM3U, crossSource, subsonicUser };
+    const subsonicPassword = document.getElementById('subsonic-password').value;
+    if (subsonicPassword) {
+        payload.subsonicPassword = subsonicPassword;
+    }
 
     try {
         const resp = await fetch('/api/v1/settings', {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({ downloadDir, quality })
+            body: JSON.stringify(payload)
         });
         const data = await resp.json();
         toast(data.message || '保存成功', 'success');
@@ -594,13 +672,13 @@ function renderDownloads(tasks) {
                     <div class="progress-fill" style="width:${t.progress}%"></div>
                 </div>
             </div>
-            <span class="status ${t.status}">${getStatusText(t.status)}</span>
+            <span class="status ${t.status}">${getStatusText(t.status)}${t.retries && t.status === 'downloading' ? `（重试 ${t.retries}）` : ''}</span>
         </div>
     `).join('');
 }
 
 function getStatusText(status) {
-    const map = { pending: '等待中', downloading: '下载中', success: '已完成', failed: '失败' };
+    const map = { pending: '等待中', waiting: '等待网络恢复', downloading: '下载中', success: '已完成', failed: '失败' };
     return map[status] || status;
 }
 
@@ -669,6 +747,9 @@ async function loadToplistSongs(id) {
 
         if (data.code === 200 && data.data && data.data.list) {
             await renderToplistSongs(data.data.list, data.data.source || source);
+            if (data.stale) {
+                toast(`当前为缓存的排行榜数据（更新于 ${data.cachedAt}）`, 'warning');
+            }
         } else {
             songsContainer.innerHTML = '<div class="no-results">加载歌曲失败</div>';
         }
@@ -902,29 +983,37 @@ async function batchDownload(type) {
     btn.textContent = '下载中...';
     btn.disabled = true;
 
-    const br = getSelectValue('quality-select-wrapper');
-    let successCount = 0;
-    const downloadedIndexes = [];
-
-    for (const index of selectedArr) {
+    const quality = getSelectValue('quality-select-wrapper');
+    const indexes = selectedArr.filter(index => songsData[index]);
+    const songs = indexes.map(index => {
         const song = songsData[index];
-        if (!song) continue;
+        return {
+            source: song.source,
+            id: String(song.id),
+            name: song.name,
+            artist: song.artist || '',
+            album: song.album || ''
+        };
+    });
 
-        try {
-            const params = new URLSearchParams({
-                source: song.source,
-                id: song.id,
-                name: song.name,
-                artist: song.artist || '',
-                album: song.album || '',
-                br
-            });
-            await fetch('/api/v1/download?' + params);
-            successCount++;
-            downloadedIndexes.push(index);
-        } catch (err) {
-            console.error('下载失败:', song.name);
+    let successCount = 0;
+    let downloadedIndexes = [];
+    try {
+        const res = await fetch('/api/v1/download/batch', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ songs, quality })
+        });
+        const data = await res.json();
+        if (data.code === 200) {
+            successCount = data.data.total - data.data.skipped;
+            downloadedIndexes = indexes;
+        } else {
+            toast(data.message || '批量下载失败', 'error');
         }
+    } catch (err) {
+        console.error('批量下载失败:', err);
+        toast('批量下载失败', 'error');
     }
 
     // 禁用已下载歌曲的复选框并更新UI
@@ -958,7 +1047,9 @@ async function batchDownload(type) {
     updateSelectedCount(type);
     updateSelectAllState(type);
 
-    toast(`已添加 ${successCount} 首歌曲到下载队列`, 'success');
+    if (downloadedIndexes.length > 0) {
+        toast(`已添加 ${successCount} 首歌曲到下载队列`, 'success');
+    }
     btn.textContent = '批量下载';
     btn.disabled = false;
 }
@@ -993,13 +1084,13 @@ async function deletePlaylist(id, source) {
 }
 
 // 下载歌单中的歌曲
-async function downloadPlaylistSong(source, id, name, artist, album, btn) {
+async function downloadPlaylistSong(source, id, name, artist, album, duration, btn) {
     const br = getSelectValue('quality-select-wrapper');
     btn.textContent = '已加入';
     btn.disabled = true;
 
     try {
-        const params = new URLSearchParams({ source, id, name, artist: artist || '', album: album || '', br });
+        const params = new URLSearchParams({ source, id, name, artist: artist || '', album: album || '', duration: duration || 0, br });
         await fetch('/api/v1/download?' + params);
     } catch (err) {
         btn.textContent = '下载';
@@ -0,0 +1,103 @@
+package storage
+
+import "time"
+
+// CacheEntry 缓存的上游响应
+type CacheEntry struct {
+	Key    string
+	Type   string // 请求类型：search、toplists、toplist、playlist、pic
+	Source string
+	Status int
+	Body   []byte
+	Time   time.Time // 写入时间
+}
+
+// CacheStat 按类型统计的缓存情况
+type CacheStat struct {
+	Type   string `json:"type"`
+	Count  int    `json:"count"`
+	Size   int64  `json:"size"`   // 字节
+	Oldest string `json:"oldest"` // 最早写入时间
+}
+
+// GetCache 获取缓存的上游响应
+func GetCache(key string) (CacheEntry, bool) {
+	dbMu.RLock()
+	defer dbMu.RUnlock()
+
+	entry := CacheEntry{Key: key}
+	var unix int64
+	err := db.QueryRow("SELECT type, source, status, body, time FROM upstream_cache WHERE key = ?", key).
+		Scan(&entry.Type, &entry.Source, &entry.Status, &entry.Body, &unix)
+	if err != nil {
+		return CacheEntry{}, false
+	}
+	entry.Time = time.Unix(unix, 0)
+	return entry, true
+}
+
+// SetCache 保存上游响应，已存在时覆盖
+func SetCache(entry CacheEntry) error {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO upstream_cache (key, type, source, status, body, time)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, entry.Key, entry.Type, entry.Source, entry.Status, entry.Body, entry.Time.Unix())
+	return err
+}
+
+// PurgeCache 删除缓存，type、source 为空时不限制，返回删除条数
+func PurgeCache(cacheType, source string) (int64, error) {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+
+	result, err := db.Exec(`
+		DELETE FROM upstream_cache
+		WHERE (? = '' OR type = ?) AND (? = '' OR source = ?)
+	`, cacheType, cacheType, source, source)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// PruneCache 删除写入时间早于 before 的缓存，返回删除条数
+func PruneCache(before time.Time) (int64, error) {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+
+	result, err := db.Exec("DELETE FROM upstream_cache WHERE time < ?", before.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetCacheStats 按类型统计缓存
+func GetCacheStats() []CacheStat {
+	dbMu.RLock()
+	defer dbMu.RUnlock()
+
+	rows, err := db.Query(`
+		SELECT type, COUNT(*), COALESCE(SUM(LENGTH(body)), 0), MIN(time)
+		FROM upstream_cache GROUP BY type ORDER BY type
+	`)
+	if err != nil {
+		return []CacheStat{}
+	}
+	defer rows.Close()
+
+	stats := []CacheStat{}
+	for rows.Next() {
+		var stat CacheStat
+		var oldest int64
+		if err := rows.Scan(&stat.Type, &stat.Count, &stat.Size, &oldest); err != nil {
+			continue
+		}
+		stat.Oldest = time.Unix(oldest, 0).Format("2006-01-02 15:04:05")
+		stats = append(stats, stat)
+	}
+	return stats
+}
@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+)
+
+// insertPlaylistSongs 按顺序追加歌单歌曲，已存在的歌曲会被跳过（调用前需持有锁）
+func insertPlaylistSongs(tx *sql.Tx, playlistID, playlistSource string, songs []PlaylistSong) error {
+	var position int
+	err := tx.QueryRow(`
+		SELECT COALESCE(MAX(position) + 1, 0) FROM playlist_songs
+		WHERE playlist_id = ? AND playlist_source = ?
+	`, playlistID, playlistSource).Scan(&position)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT OR IGNORE INTO playlist_songs (playlist_id, playlist_source, song_source, song_id, name, artist, album, types, duration, position)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, song := range songs {
+		songSource := song.Source
+		if songSource == "" {
+			songSource = playlistSource
+		}
+		typesJSON, _ := json.Marshal(song.Types)
+		result, err := stmt.Exec(playlistID, playlistSource, songSource, song.ID, song.Name,
+			song.Artist, song.Album, string(typesJSON), song.Duration, position)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			position++
+		}
+	}
+	return nil
+}
+
+// playlistExists 检查歌单是否存在（调用前需持有锁）
+func playlistExists(q interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}, id, source string) bool {
+	var count int
+	err := q.QueryRow("SELECT COUNT(*) FROM playlists WHERE id = ? AND source = ?", id, source).Scan(&count)
+	return err == nil && count > 0
+}
+
+// UpdatePlaylistInfo 更新歌单名称、简介和封面
+func UpdatePlaylistInfo(id, source, name, description, cover string) error {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+
+	result, err := db.Exec(`
+		UPDATE playlists SET name = ?, description = ?, cover = ?
+		WHERE id = ? AND source = ?
+	`, name, description, cover, id, source)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrPlaylistNotFound
+	}
+	return nil
+}
+
+// AddPlaylistSongs 向歌单末尾追加歌曲，返回实际新增的数量
+func AddPlaylistSongs(id, source string, songs []PlaylistSong) (int, error) {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	if !playlistExists(tx, id, source) {
+		tx.Rollback()
+		return 0, ErrPlaylistNotFound
+	}
+
+	var before, after int
+	countQuery := "SELECT COUNT(*) FROM playlist_songs WHERE playlist_id = ? AND playlist_source = ?"
+	tx.QueryRow(countQuery, id, source).Scan(&before)
+
+	if err = insertPlaylistSongs(tx, id, source, songs); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	tx.QueryRow(countQuery, id, source).Scan(&after)
+	return after - before, tx.Commit()
+}
+
+// RemovePlaylistSongs 从歌单中移除歌曲，返回实际移除的数量
+func RemovePlaylistSongs(id, source string, refs []SongRef) (int, error) {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	if !playlistExists(tx, id, source) {
+		tx.Rollback()
+		return 0, ErrPlaylistNotFound
+	}
+
+	removed := 0
+	for _, ref := range refs {
+		result, err := tx.Exec(`
+			DELETE FROM playlist_songs
+			WHERE playlist_id = ? AND playlist_source = ? AND song_source = ? AND song_id = ?
+		`, id, source, ref.Source, ref.ID)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		n, _ := result.RowsAffected()
+		removed += int(n)
+	}
+	return removed, tx.Commit()
+}
+
+// ReorderPlaylistSongs 按给定顺序重排歌单，未列出的歌曲保持原有相对顺序排在末尾
+func ReorderPlaylistSongs(id, source string, order []SongRef) error {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+
+	if !playlistExists(db, id, source) {
+		return ErrPlaylistNotFound
+	}
+	songs := getPlaylistSongs(id, source)
+
+	index := make(map[SongRef]int, len(songs))
+	for i, s := range songs {
+		index[SongRef{ID: s.ID, Source: s.Source}] = i
+	}
+
+	reordered := make([]PlaylistSong, 0, len(songs))
+	used := make([]bool, len(songs))
+	for _, ref := range order {
+		if i, ok := index[ref]; ok && !used[i] {
+			used[i] = true
+			reordered = append(reordered, songs[i])
+		}
+	}
+	for i, s := range songs {
+		if !used[i] {
+			reordered = append(reordered, s)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`
+		UPDATE playlist_songs SET position = ?
+		WHERE playlist_id = ? AND playlist_source = ? AND song_source = ? AND song_id = ?
+	`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for i, s := range reordered {
+		if _, err := stmt.Exec(i, id, source, s.Source, s.ID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// PlaylistSongLibrary 歌单歌曲及其在音乐库中的记录
+type PlaylistSongLibrary struct {
+	PlaylistSong
+	InLibrary bool   `json:"inLibrary"`
+	Path      string `json:"path,omitempty"`
+	Quality   string `json:"quality,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+}
+
+// GetPlaylistSongsWithLibrary 获取歌单歌曲并关联音乐库记录
+func GetPlaylistSongsWithLibrary(id, source string) ([]PlaylistSongLibrary, error) {
+	dbMu.RLock()
+	defer dbMu.RUnlock()
+
+	if !playlistExists(db, id, source) {
+		return nil, ErrPlaylistNotFound
+	}
+
+	rows, err := db.Query(`
+		SELECT ps.song_id, ps.song_source, ps.name, ps.artist, ps.album, ps.position,
+			l.id IS NOT NULL, COALESCE(l.path, ''), COALESCE(l.quality, ''), COALESCE(l.size, 0)
+		FROM playlist_songs AS ps
+		LEFT JOIN library AS l ON l.id = ps.song_id AND l.source = ps.song_source
+		WHERE ps.playlist_id = ? AND ps.playlist_source = ?
+		ORDER BY ps.position, ps.rowid
+	`, id, source)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	songs := []PlaylistSongLibrary{}
+	for rows.Next() {
+		var s PlaylistSongLibrary
+		if err := rows.Scan(&s.ID, &s.Source, &s.Name, &s.Artist, &s.Album, &s.Position,
+			&s.InLibrary, &s.Path, &s.Quality, &s.Size); err != nil {
+			continue
+		}
+		songs = append(songs, s)
+	}
+	return songs, nil
+}
@@ -0,0 +1,130 @@
+package storage
+
+import "os"
+
+// StatGroup 分组统计
+type StatGroup struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+	Bytes int64  `json:"bytes"`
+}
+
+// DayStat 每日下载统计
+type DayStat struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+	Bytes int64  `json:"bytes"`
+}
+
+// LibraryStats 音乐库统计
+type LibraryStats struct {
+	TotalSongs      int         `json:"totalSongs"`
+	TotalBytes      int64       `json:"totalBytes"`
+	BySource        []StatGroup `json:"bySource"`
+	ByFormat        []StatGroup `json:"byFormat"`
+	ByQuality       []StatGroup `json:"byQuality"`
+	TopArtists      []StatGroup `json:"topArtists"`
+	DownloadsPerDay []DayStat   `json:"downloadsPerDay"`
+	MissingFiles    int         `json:"missingFiles"`
+}
+
+// GetLibraryStats 统计音乐库，topN 为艺术家排行数量
+func GetLibraryStats(topN int) (LibraryStats, error) {
+	dbMu.RLock()
+	defer dbMu.RUnlock()
+
+	var stats LibraryStats
+	err := db.QueryRow("SELECT COUNT(*), COALESCE(SUM(size), 0) FROM library").
+		Scan(&stats.TotalSongs, &stats.TotalBytes)
+	if err != nil {
+		return stats, err
+	}
+
+	if stats.BySource, err = queryStatGroups(`
+		SELECT source, COUNT(*), COALESCE(SUM(size), 0)
+		FROM library GROUP BY source ORDER BY COUNT(*) DESC
+	`); err != nil {
+		return stats, err
+	}
+
+	if stats.ByFormat, err = queryStatGroups(`
+		SELECT CASE
+				WHEN lower(path) LIKE '%.flac' THEN 'flac'
+				WHEN lower(path) LIKE '%.mp3' THEN 'mp3'
+				ELSE 'other'
+			END AS format, COUNT(*), COALESCE(SUM(size), 0)
+		FROM library GROUP BY format ORDER BY COUNT(*) DESC
+	`); err != nil {
+		return stats, err
+	}
+
+	if stats.ByQuality, err = queryStatGroups(`
+		SELECT COALESCE(NULLIF(quality, ''), 'unknown') AS q, COUNT(*), COALESCE(SUM(size), 0)
+		FROM library GROUP BY q ORDER BY COUNT(*) DESC
+	`); err != nil {
+		return stats, err
+	}
+
+	if stats.TopArtists, err = queryStatGroups(`
+		SELECT artist, COUNT(*), COALESCE(SUM(size), 0)
+		FROM library GROUP BY artist ORDER BY COUNT(*) DESC, artist LIMIT ?
+	`, topN); err != nil {
+		return stats, err
+	}
+
+	rows, err := db.Query(`
+		SELECT substr(time, 1, 10) AS day, COUNT(*), COALESCE(SUM(size), 0)
+		FROM library GROUP BY day ORDER BY day
+	`)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+
+	stats.DownloadsPerDay = []DayStat{}
+	for rows.Next() {
+		var d DayStat
+		if err := rows.Scan(&d.Date, &d.Count, &d.Bytes); err != nil {
+			continue
+		}
+		stats.DownloadsPerDay = append(stats.DownloadsPerDay, d)
+	}
+
+	// 文件是否存在无法用 SQL 判断，逐个检查路径
+	pathRows, err := db.Query("SELECT path FROM library")
+	if err != nil {
+		return stats, err
+	}
+	defer pathRows.Close()
+
+	for pathRows.Next() {
+		var path string
+		if err := pathRows.Scan(&path); err != nil {
+			continue
+		}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			stats.MissingFiles++
+		}
+	}
+
+	return stats, nil
+}
+
+// queryStatGroups 执行分组统计查询（调用前需持有锁）
+func queryStatGroups(query string, args ...interface{}) ([]StatGroup, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []StatGroup{}
+	for rows.Next() {
+		var g StatGroup
+		if err := rows.Scan(&g.Key, &g.Count, &g.Bytes); err != nil {
+			continue
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
@@ -3,8 +3,10 @@ package storage
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
 
 	_ "modernc.org/sqlite"
@@ -17,28 +19,53 @@ type AppData struct {
 	Playlists []Playlist       `json:"playlists"`
 }
 
+// LocalSource 本地创建的歌单来源
+const LocalSource = "local"
+
+// ErrPlaylistNotFound 歌单不存在
+var ErrPlaylistNotFound = errors.New("playlist not found")
+
 // Playlist 导入的歌单
 type Playlist struct {
-	ID     string         `json:"id"`
-	Source string         `json:"source"`
-	Name   string         `json:"name"`
-	Author string         `json:"author"`
-	Songs  []PlaylistSong `json:"songs"`
+	ID          string         `json:"id"`
+	Source      string         `json:"source"`
+	Name        string         `json:"name"`
+	Author      string         `json:"author"`
+	Description string         `json:"description"`
+	Cover       string         `json:"cover"`
+	Songs       []PlaylistSong `json:"songs"`
 }
 
 // PlaylistSong 歌单中的歌曲
 type PlaylistSong struct {
-	ID     string   `json:"id"`
-	Name   string   `json:"name"`
-	Artist string   `json:"artist"`
-	Album  string   `json:"album"`
-	Types  []string `json:"types"`
+	ID       string   `json:"id"`
+	Source   string   `json:"source"` // 歌曲来源，本地歌单可混合不同来源
+	Name     string   `json:"name"`
+	Artist   string   `json:"artist"`
+	Album    string   `json:"album"`
+	Types    []string `json:"types"`
+	Duration int      `json:"duration,omitempty"` // 时长（秒），未知为 0
+	Position int      `json:"position"`           // 在歌单中的位置，从 0 开始
+}
+
+// SongRef 歌曲引用
+type SongRef struct {
+	ID     string `json:"id"`
+	Source string `json:"source"`
 }
 
 // Settings 设置
 type Settings struct {
-	DownloadDir string `json:"downloadDir"`
-	Quality     string `json:"quality"`
+	DownloadDir    string `json:"downloadDir"`
+	Quality        string `json:"quality"`
+	MinFreeSpace   int64  `json:"minFreeSpace"`   // 最小剩余空间 (MB)，0 表示不限制
+	MaxLibrarySize int64  `json:"maxLibrarySize"` // 音乐库容量上限 (MB)，0 表示不限制
+	StreamCache    bool   `json:"streamCache"`    // 代理播放时是否缓存音频文件
+	AutoM3U        bool   `json:"autoM3U"`        // 歌单变化时自动写入 .m3u8 到下载目录
+	CrossSource    bool   `json:"crossSource"`    // 原音源下载失败时从其他音源匹配同一首歌
+	// Subsonic 兼容接口的账号，密码为空时禁用
+	SubsonicUser     string `json:"subsonicUser"`
+	SubsonicPassword string `json:"subsonicPassword"`
 }
 
 // DownloadedSong 已下载歌曲
@@ -51,6 +78,13 @@ type DownloadedSong struct {
 	Filename string `json:"filename"`
 	Path     string `json:"path"`
 	Time     string `json:"time"`
+	Quality  string `json:"quality"`
+	Size     int64  `json:"size"`
+	Duration int    `json:"duration,omitempty"` // 时长（秒），未知为 0
+	// 原音源不可用时实际下载的音源、歌曲ID及匹配分数，未替换时为空
+	MatchSource string  `json:"matchSource,omitempty"`
+	MatchID     string  `json:"matchId,omitempty"`
+	MatchScore  float64 `json:"matchScore,omitempty"`
 }
 
 var (
@@ -93,6 +127,9 @@ func initTables() error {
 	_, err = db.Exec(`
 		INSERT OR IGNORE INTO settings (key, value) VALUES ('downloadDir', './downloads');
 		INSERT OR IGNORE INTO settings (key, value) VALUES ('quality', '320k');
+		INSERT OR IGNORE INTO settings (key, value) VALUES ('minFreeSpace', '0');
+		INSERT OR IGNORE INTO settings (key, value) VALUES ('maxLibrarySize', '0');
+		INSERT OR IGNORE INTO settings (key, value) VALUES ('streamCache', '0');
 	`)
 	if err != nil {
 		return err
@@ -116,6 +153,27 @@ func initTables() error {
 		return err
 	}
 
+	// 音质字段（旧版本数据库没有该列）
+	if err = addColumnIfMissing("library", "quality", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err = addColumnIfMissing("library", "size", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	// 跨音源替换记录
+	if err = addColumnIfMissing("library", "match_source", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err = addColumnIfMissing("library", "match_id", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err = addColumnIfMissing("library", "match_score", "REAL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err = addColumnIfMissing("library", "duration", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+
 	// 歌单表
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS playlists (
@@ -130,29 +188,272 @@ func initTables() error {
 		return err
 	}
 
+	if err = addColumnIfMissing("playlists", "description", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err = addColumnIfMissing("playlists", "cover", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+
 	// 歌单歌曲表
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS playlist_songs (
 			playlist_id TEXT,
 			playlist_source TEXT,
+			song_source TEXT,
 			song_id TEXT,
 			name TEXT,
 			artist TEXT,
 			album TEXT,
 			types TEXT,
-			PRIMARY KEY (playlist_id, playlist_source, song_id),
+			position INTEGER DEFAULT 0,
+			PRIMARY KEY (playlist_id, playlist_source, song_source, song_id),
 			FOREIGN KEY (playlist_id, playlist_source) REFERENCES playlists(id, source) ON DELETE CASCADE
 		)
 	`)
 	if err != nil {
 		return err
 	}
+	if err = migratePlaylistSongSource(); err != nil {
+		return err
+	}
+	if err = migratePlaylistSongPosition(); err != nil {
+		return err
+	}
+	if err = addColumnIfMissing("playlist_songs", "duration", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// 歌单同步记录表
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS playlist_syncs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			playlist_id TEXT,
+			playlist_source TEXT,
+			time TEXT,
+			added INTEGER DEFAULT 0,
+			removed INTEGER DEFAULT 0,
+			moved INTEGER DEFAULT 0,
+			diff TEXT,
+			error TEXT DEFAULT ''
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	if err = addColumnIfMissing("playlist_syncs", "trigger", "TEXT DEFAULT 'manual'"); err != nil {
+		return err
+	}
+	if err = addColumnIfMissing("playlist_syncs", "queued", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// 歌单订阅表
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS subscriptions (
+			playlist_id TEXT,
+			playlist_source TEXT,
+			interval INTEGER DEFAULT 1440,
+			quality TEXT DEFAULT '',
+			auto_download INTEGER DEFAULT 1,
+			enabled INTEGER DEFAULT 1,
+			last_sync TEXT DEFAULT '',
+			PRIMARY KEY (playlist_id, playlist_source)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 排行榜快照表
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS toplist_snapshots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			source TEXT,
+			toplist_id TEXT,
+			time TEXT
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS toplist_snapshot_songs (
+			snapshot_id INTEGER,
+			rank INTEGER,
+			song_id TEXT,
+			song_source TEXT,
+			name TEXT,
+			artist TEXT,
+			album TEXT,
+			PRIMARY KEY (snapshot_id, rank),
+			FOREIGN KEY (snapshot_id) REFERENCES toplist_snapshots(id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	if err = addColumnIfMissing("toplist_snapshot_songs", "duration", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// 排行榜订阅表
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS toplist_subscriptions (
+			source TEXT,
+			toplist_id TEXT,
+			name TEXT,
+			keep_top INTEGER DEFAULT 10,
+			interval INTEGER DEFAULT 1440,
+			quality TEXT DEFAULT '',
+			mirror INTEGER DEFAULT 0,
+			enabled INTEGER DEFAULT 1,
+			last_sync TEXT DEFAULT '',
+			last_error TEXT DEFAULT '',
+			PRIMARY KEY (source, toplist_id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 播放记录表（Subsonic scrobble）
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS scrobbles (
+			song_id TEXT,
+			song_source TEXT,
+			time TEXT
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 上游响应缓存表
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS upstream_cache (
+			key TEXT PRIMARY KEY,
+			type TEXT,
+			source TEXT,
+			status INTEGER,
+			body BLOB,
+			time INTEGER
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_upstream_cache_time ON upstream_cache (time)")
+	if err != nil {
+		return err
+	}
 
 	// 启用外键约束
 	_, err = db.Exec("PRAGMA foreign_keys = ON")
 	return err
 }
 
+// addColumnIfMissing 为旧表补充新增的列
+func addColumnIfMissing(table, column, definition string) error {
+	exists, err := hasColumn(table, column)
+	if err != nil || exists {
+		return err
+	}
+	_, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	return err
+}
+
+// hasColumn 检查表中是否存在某列
+func hasColumn(table, column string) (bool, error) {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// migratePlaylistSongSource 旧版 playlist_songs 没有 song_source 列，
+// 且主键不含来源，需要重建表；旧数据的歌曲来源即歌单来源
+func migratePlaylistSongSource() error {
+	exists, err := hasColumn("playlist_songs", "song_source")
+	if err != nil || exists {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	stmts := []string{
+		`CREATE TABLE playlist_songs_new (
+			playlist_id TEXT,
+			playlist_source TEXT,
+			song_source TEXT,
+			song_id TEXT,
+			name TEXT,
+			artist TEXT,
+			album TEXT,
+			types TEXT,
+			PRIMARY KEY (playlist_id, playlist_source, song_source, song_id),
+			FOREIGN KEY (playlist_id, playlist_source) REFERENCES playlists(id, source) ON DELETE CASCADE
+		)`,
+		`INSERT INTO playlist_songs_new (playlist_id, playlist_source, song_source, song_id, name, artist, album, types)
+			SELECT playlist_id, playlist_source, playlist_source, song_id, name, artist, album, types
+			FROM playlist_songs ORDER BY rowid`,
+		`DROP TABLE playlist_songs`,
+		`ALTER TABLE playlist_songs_new RENAME TO playlist_songs`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// migratePlaylistSongPosition 为旧数据补充 position 列，按原插入顺序编号
+func migratePlaylistSongPosition() error {
+	exists, err := hasColumn("playlist_songs", "position")
+	if err != nil || exists {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("ALTER TABLE playlist_songs ADD COLUMN position INTEGER DEFAULT 0")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE playlist_songs SET position = (
+			SELECT COUNT(*) FROM playlist_songs AS p
+			WHERE p.playlist_id = playlist_songs.playlist_id
+				AND p.playlist_source = playlist_songs.playlist_source
+				AND p.rowid < playlist_songs.rowid
+		)
+	`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
 // Close 关闭数据库连接
 func Close() error {
 	if db != nil {
@@ -187,6 +488,20 @@ func GetSettings() Settings {
 			settings.DownloadDir = value
 		case "quality":
 			settings.Quality = value
+		case "minFreeSpace":
+			settings.MinFreeSpace, _ = strconv.ParseInt(value, 10, 64)
+		case "maxLibrarySize":
+			settings.MaxLibrarySize, _ = strconv.ParseInt(value, 10, 64)
+		case "streamCache":
+			settings.StreamCache = value == "1"
+		case "autoM3U":
+			settings.AutoM3U = value == "1"
+		case "crossSource":
+			settings.CrossSource = value == "1"
+		case "subsonicUser":
+			settings.SubsonicUser = value
+		case "subsonicPassword":
+			settings.SubsonicPassword = value
 		}
 	}
 	return settings
@@ -197,12 +512,38 @@ func UpdateSettings(s Settings) error {
 	dbMu.Lock()
 	defer dbMu.Unlock()
 
-	_, err := db.Exec("UPDATE settings SET value = ? WHERE key = 'downloadDir'", s.DownloadDir)
+	values := [][2]string{
+		{"downloadDir", s.DownloadDir},
+		{"quality", s.Quality},
+		{"minFreeSpace", strconv.FormatInt(s.MinFreeSpace, 10)},
+		{"maxLibrarySize", strconv.FormatInt(s.MaxLibrarySize, 10)},
+		{"streamCache", boolSetting(s.StreamCache)},
+		{"autoM3U", boolSetting(s.AutoM3U)},
+		{"crossSource", boolSetting(s.CrossSource)},
+		{"subsonicUser", s.SubsonicUser},
+		{"subsonicPassword", s.SubsonicPassword},
+	}
+
+	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
-	_, err = db.Exec("UPDATE settings SET value = ? WHERE key = 'quality'", s.Quality)
-	return err
+	for _, kv := range values {
+		_, err = tx.Exec("INSERT OR REPLACE INTO settings (key, value) VALUES (?, ?)", kv[0], kv[1])
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// boolSetting 布尔设置以 0/1 保存
+func boolSetting(v bool) string {
+	if v {
+		return "1"
+	}
+	return "0"
 }
 
 // GetLibrary 获取音乐库
@@ -210,7 +551,11 @@ func GetLibrary() []DownloadedSong {
 	dbMu.RLock()
 	defer dbMu.RUnlock()
 
-	rows, err := db.Query("SELECT id, source, name, artist, album, filename, path, time FROM library")
+	rows, err := db.Query(`
+		SELECT id, source, name, artist, album, filename, path, time, quality, size, duration,
+			match_source, match_id, match_score
+		FROM library
+	`)
 	if err != nil {
 		return []DownloadedSong{}
 	}
@@ -220,7 +565,8 @@ func GetLibrary() []DownloadedSong {
 	for rows.Next() {
 		var song DownloadedSong
 		err := rows.Scan(&song.ID, &song.Source, &song.Name, &song.Artist,
-			&song.Album, &song.Filename, &song.Path, &song.Time)
+			&song.Album, &song.Filename, &song.Path, &song.Time, &song.Quality, &song.Size, &song.Duration,
+			&song.MatchSource, &song.MatchID, &song.MatchScore)
 		if err != nil {
 			continue
 		}
@@ -239,9 +585,11 @@ func AddToLibrary(song DownloadedSong) error {
 	defer dbMu.Unlock()
 
 	_, err := db.Exec(`
-		INSERT OR REPLACE INTO library (id, source, name, artist, album, filename, path, time)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-	`, song.ID, song.Source, song.Name, song.Artist, song.Album, song.Filename, song.Path, song.Time)
+		INSERT OR REPLACE INTO library (id, source, name, artist, album, filename, path, time, quality, size, duration,
+			match_source, match_id, match_score)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, song.ID, song.Source, song.Name, song.Artist, song.Album, song.Filename, song.Path, song.Time, song.Quality, song.Size, song.Duration,
+		song.MatchSource, song.MatchID, song.MatchScore)
 	return err
 }
 
@@ -262,8 +610,9 @@ func SetLibrary(songs []DownloadedSong) error {
 	}
 
 	stmt, err := tx.Prepare(`
-		INSERT INTO library (id, source, name, artist, album, filename, path, time)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO library (id, source, name, artist, album, filename, path, time, quality, size, duration,
+			match_source, match_id, match_score)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`)
 	if err != nil {
 		tx.Rollback()
@@ -273,7 +622,8 @@ func SetLibrary(songs []DownloadedSong) error {
 
 	for _, song := range songs {
 		_, err = stmt.Exec(song.ID, song.Source, song.Name, song.Artist,
-			song.Album, song.Filename, song.Path, song.Time)
+			song.Album, song.Filename, song.Path, song.Time, song.Quality, song.Size, song.Duration,
+			song.MatchSource, song.MatchID, song.MatchScore)
 		if err != nil {
 			tx.Rollback()
 			return err
@@ -333,7 +683,7 @@ func GetPlaylists() []Playlist {
 	dbMu.RLock()
 	defer dbMu.RUnlock()
 
-	rows, err := db.Query("SELECT id, source, name, author FROM playlists")
+	rows, err := db.Query("SELECT id, source, name, author, description, cover FROM playlists")
 	if err != nil {
 		return []Playlist{}
 	}
@@ -342,7 +692,7 @@ func GetPlaylists() []Playlist {
 	var playlists []Playlist
 	for rows.Next() {
 		var p Playlist
-		if err := rows.Scan(&p.ID, &p.Source, &p.Name, &p.Author); err != nil {
+		if err := rows.Scan(&p.ID, &p.Source, &p.Name, &p.Author, &p.Description, &p.Cover); err != nil {
 			continue
 		}
 		p.Songs = getPlaylistSongs(p.ID, p.Source)
@@ -355,12 +705,28 @@ func GetPlaylists() []Playlist {
 	return playlists
 }
 
+// GetPlaylist 获取单个歌单
+func GetPlaylist(id, source string) (Playlist, bool) {
+	dbMu.RLock()
+	defer dbMu.RUnlock()
+
+	var p Playlist
+	err := db.QueryRow("SELECT id, source, name, author, description, cover FROM playlists WHERE id = ? AND source = ?", id, source).
+		Scan(&p.ID, &p.Source, &p.Name, &p.Author, &p.Description, &p.Cover)
+	if err != nil {
+		return Playlist{}, false
+	}
+	p.Songs = getPlaylistSongs(p.ID, p.Source)
+	return p, true
+}
+
 // getPlaylistSongs 获取歌单中的歌曲（内部函数，调用前需持有锁）
 func getPlaylistSongs(playlistID, playlistSource string) []PlaylistSong {
 	rows, err := db.Query(`
-		SELECT song_id, name, artist, album, types
+		SELECT song_id, song_source, name, artist, album, types, duration, position
 		FROM playlist_songs
 		WHERE playlist_id = ? AND playlist_source = ?
+		ORDER BY position, rowid
 	`, playlistID, playlistSource)
 	if err != nil {
 		return []PlaylistSong{}
@@ -371,7 +737,7 @@ func getPlaylistSongs(playlistID, playlistSource string) []PlaylistSong {
 	for rows.Next() {
 		var s PlaylistSong
 		var typesJSON string
-		if err := rows.Scan(&s.ID, &s.Name, &s.Artist, &s.Album, &typesJSON); err != nil {
+		if err := rows.Scan(&s.ID, &s.Source, &s.Name, &s.Artist, &s.Album, &typesJSON, &s.Duration, &s.Position); err != nil {
 			continue
 		}
 		json.Unmarshal([]byte(typesJSON), &s.Types)
@@ -404,34 +770,19 @@ func AddPlaylist(playlist Playlist) error {
 
 	// 插入或更新歌单
 	_, err = tx.Exec(`
-		INSERT OR REPLACE INTO playlists (id, source, name, author)
-		VALUES (?, ?, ?, ?)
-	`, playlist.ID, playlist.Source, playlist.Name, playlist.Author)
+		INSERT OR REPLACE INTO playlists (id, source, name, author, description, cover)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, playlist.ID, playlist.Source, playlist.Name, playlist.Author, playlist.Description, playlist.Cover)
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
 
 	// 插入歌曲
-	stmt, err := tx.Prepare(`
-		INSERT INTO playlist_songs (playlist_id, playlist_source, song_id, name, artist, album, types)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`)
-	if err != nil {
+	if err = insertPlaylistSongs(tx, playlist.ID, playlist.Source, playlist.Songs); err != nil {
 		tx.Rollback()
 		return err
 	}
-	defer stmt.Close()
-
-	for _, song := range playlist.Songs {
-		typesJSON, _ := json.Marshal(song.Types)
-		_, err = stmt.Exec(playlist.ID, playlist.Source, song.ID, song.Name,
-			song.Artist, song.Album, string(typesJSON))
-		if err != nil {
-			tx.Rollback()
-			return err
-		}
-	}
 
 	return tx.Commit()
 }
@@ -447,7 +798,25 @@ func DeletePlaylist(id, source string) error {
 		return err
 	}
 
+	_, err = db.Exec("DELETE FROM playlist_syncs WHERE playlist_id = ? AND playlist_source = ?", id, source)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("DELETE FROM subscriptions WHERE playlist_id = ? AND playlist_source = ?", id, source)
+	if err != nil {
+		return err
+	}
+
 	// 再删除歌单
 	_, err = db.Exec("DELETE FROM playlists WHERE id = ? AND source = ?", id, source)
 	return err
 }
+
+// AddScrobble 记录一次播放
+func AddScrobble(id, source, playedAt string) error {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+
+	_, err := db.Exec("INSERT INTO scrobbles (song_id, song_source, time) VALUES (?, ?, ?)", id, source, playedAt)
+	return err
+}
@@ -0,0 +1,94 @@
+package storage
+
+// Subscription 歌单订阅，定时同步并可自动下载新增歌曲
+type Subscription struct {
+	PlaylistID     string `json:"playlistId"`
+	PlaylistSource string `json:"playlistSource"`
+	PlaylistName   string `json:"playlistName"`
+	Interval       int    `json:"interval"` // 同步间隔（分钟）
+	Quality        string `json:"quality"`  // 自动下载音质，为空时使用全局设置
+	AutoDownload   bool   `json:"autoDownload"`
+	Enabled        bool   `json:"enabled"`
+	LastSync       string `json:"lastSync"`
+}
+
+// GetSubscriptions 获取所有订阅
+func GetSubscriptions() []Subscription {
+	dbMu.RLock()
+	defer dbMu.RUnlock()
+
+	rows, err := db.Query(`
+		SELECT s.playlist_id, s.playlist_source, COALESCE(p.name, ''), s.interval, s.quality,
+			s.auto_download, s.enabled, s.last_sync
+		FROM subscriptions AS s
+		LEFT JOIN playlists AS p ON p.id = s.playlist_id AND p.source = s.playlist_source
+		ORDER BY s.rowid
+	`)
+	if err != nil {
+		return []Subscription{}
+	}
+	defer rows.Close()
+
+	subs := []Subscription{}
+	for rows.Next() {
+		var s Subscription
+		if err := rows.Scan(&s.PlaylistID, &s.PlaylistSource, &s.PlaylistName, &s.Interval, &s.Quality,
+			&s.AutoDownload, &s.Enabled, &s.LastSync); err != nil {
+			continue
+		}
+		subs = append(subs, s)
+	}
+	return subs
+}
+
+// GetSubscription 获取单个歌单的订阅
+func GetSubscription(id, source string) (Subscription, bool) {
+	for _, s := range GetSubscriptions() {
+		if s.PlaylistID == id && s.PlaylistSource == source {
+			return s, true
+		}
+	}
+	return Subscription{}, false
+}
+
+// SetSubscription 新建或修改订阅，保留上次同步时间
+func SetSubscription(s Subscription) error {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+
+	if !playlistExists(db, s.PlaylistID, s.PlaylistSource) {
+		return ErrPlaylistNotFound
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO subscriptions (playlist_id, playlist_source, interval, quality, auto_download, enabled)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (playlist_id, playlist_source) DO UPDATE SET
+			interval = excluded.interval,
+			quality = excluded.quality,
+			auto_download = excluded.auto_download,
+			enabled = excluded.enabled
+	`, s.PlaylistID, s.PlaylistSource, s.Interval, s.Quality, s.AutoDownload, s.Enabled)
+	return err
+}
+
+// DeleteSubscription 取消订阅
+func DeleteSubscription(id, source string) error {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+
+	_, err := db.Exec("DELETE FROM subscriptions WHERE playlist_id = ? AND playlist_source = ?", id, source)
+	return err
+}
+
+// SetSubscriptionSynced 记录订阅的同步时间
+func SetSubscriptionSynced(id, source, syncTime string) error {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+
+	_, err := db.Exec(`
+		UPDATE subscriptions SET last_sync = ?
+		WHERE playlist_id = ? AND playlist_source = ?
+	`, syncTime, id, source)
+	return err
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+)
+
+// SongMove 位置发生变化的歌曲
+type SongMove struct {
+	ID     string `json:"id"`
+	Source string `json:"source"`
+	Name   string `json:"name"`
+	Artist string `json:"artist"`
+	From   int    `json:"from"`
+	To     int    `json:"to"`
+}
+
+// PlaylistDiff 歌单同步前后的差异
+type PlaylistDiff struct {
+	Added   []PlaylistSong `json:"added"`
+	Removed []PlaylistSong `json:"removed"`
+	Moved   []SongMove     `json:"moved"`
+}
+
+// PlaylistSync 歌单同步记录
+type PlaylistSync struct {
+	ID             int64        `json:"id"`
+	PlaylistID     string       `json:"playlistId"`
+	PlaylistSource string       `json:"playlistSource"`
+	Time           string       `json:"time"`
+	Added          int          `json:"added"`
+	Removed        int          `json:"removed"`
+	Moved          int          `json:"moved"`
+	Diff           PlaylistDiff `json:"diff"`
+	Error          string       `json:"error,omitempty"`
+	Trigger        string       `json:"trigger"` // manual 手动 / schedule 定时
+	Queued         int          `json:"queued"`  // 自动加入下载队列的歌曲数
+}
+
+// syncColumns 同步记录查询的列，与 scanPlaylistSyncs 对应
+const syncColumns = "id, playlist_id, playlist_source, time, added, removed, moved, diff, error, trigger, queued"
+
+// AddPlaylistSync 保存一条同步记录，返回记录ID
+func AddPlaylistSync(s PlaylistSync) (int64, error) {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+
+	diffJSON, _ := json.Marshal(s.Diff)
+	result, err := db.Exec(`
+		INSERT INTO playlist_syncs (playlist_id, playlist_source, time, added, removed, moved, diff, error, trigger, queued)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, s.PlaylistID, s.PlaylistSource, s.Time, s.Added, s.Removed, s.Moved, string(diffJSON), s.Error, s.Trigger, s.Queued)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetPlaylistSyncs 获取歌单的同步记录，最新的在前
+func GetPlaylistSyncs(id, source string, limit int) []PlaylistSync {
+	dbMu.RLock()
+	defer dbMu.RUnlock()
+
+	rows, err := db.Query(`
+		SELECT `+syncColumns+`
+		FROM playlist_syncs
+		WHERE playlist_id = ? AND playlist_source = ?
+		ORDER BY id DESC LIMIT ?
+	`, id, source, limit)
+	if err != nil {
+		return []PlaylistSync{}
+	}
+	defer rows.Close()
+
+	return scanPlaylistSyncs(rows)
+}
+
+// GetSyncLog 获取所有歌单的同步记录，最新的在前
+func GetSyncLog(limit int) []PlaylistSync {
+	dbMu.RLock()
+	defer dbMu.RUnlock()
+
+	rows, err := db.Query(`
+		SELECT `+syncColumns+`
+		FROM playlist_syncs
+		ORDER BY id DESC LIMIT ?
+	`, limit)
+	if err != nil {
+		return []PlaylistSync{}
+	}
+	defer rows.Close()
+
+	return scanPlaylistSyncs(rows)
+}
+
+// scanPlaylistSyncs 读取同步记录查询结果
+func scanPlaylistSyncs(rows *sql.Rows) []PlaylistSync {
+	syncs := []PlaylistSync{}
+	for rows.Next() {
+		var s PlaylistSync
+		var diffJSON string
+		if err := rows.Scan(&s.ID, &s.PlaylistID, &s.PlaylistSource, &s.Time,
+			&s.Added, &s.Removed, &s.Moved, &diffJSON, &s.Error, &s.Trigger, &s.Queued); err != nil {
+			continue
+		}
+		json.Unmarshal([]byte(diffJSON), &s.Diff)
+		syncs = append(syncs, s)
+	}
+	return syncs
+}
@@ -0,0 +1,282 @@
+package storage
+
+// ToplistSong 排行榜中的歌曲
+type ToplistSong struct {
+	Rank     int    `json:"rank"` // 排名，从 1 开始
+	ID       string `json:"id"`
+	Source   string `json:"source"`
+	Name     string `json:"name"`
+	Artist   string `json:"artist"`
+	Album    string `json:"album"`
+	Duration int    `json:"duration,omitempty"` // 时长（秒），未知为 0
+}
+
+// ToplistSnapshot 排行榜快照
+type ToplistSnapshot struct {
+	ID        int64         `json:"id"`
+	Source    string        `json:"source"`
+	ToplistID string        `json:"toplistId"`
+	Time      string        `json:"time"`
+	Songs     []ToplistSong `json:"songs"`
+}
+
+// ToplistSubscription 排行榜订阅，定时下载榜单前 N 首
+type ToplistSubscription struct {
+	Source    string `json:"source"`
+	ToplistID string `json:"toplistId"`
+	Name      string `json:"name"`
+	KeepTop   int    `json:"keepTop"`  // 保持下载的前 N 首，为 0 时只保存快照
+	Interval  int    `json:"interval"` // 同步间隔（分钟）
+	Quality   string `json:"quality"`  // 下载音质，为空时使用全局设置
+	Mirror    bool   `json:"mirror"`   // 是否生成同步榜单的本地歌单
+	Enabled   bool   `json:"enabled"`
+	LastSync  string `json:"lastSync"`
+	LastError string `json:"lastError"`
+}
+
+// AddToplistSnapshot 保存排行榜快照，返回快照ID
+func AddToplistSnapshot(snap ToplistSnapshot) (int64, error) {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec("INSERT INTO toplist_snapshots (source, toplist_id, time) VALUES (?, ?, ?)",
+		snap.Source, snap.ToplistID, snap.Time)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	snapshotID, _ := result.LastInsertId()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO toplist_snapshot_songs (snapshot_id, rank, song_id, song_source, name, artist, album, duration)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	defer stmt.Close()
+
+	for _, song := range snap.Songs {
+		if _, err := stmt.Exec(snapshotID, song.Rank, song.ID, song.Source, song.Name, song.Artist, song.Album, song.Duration); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+	return snapshotID, tx.Commit()
+}
+
+// GetToplistSubscriptions 获取所有排行榜订阅
+func GetToplistSubscriptions() []ToplistSubscription {
+	dbMu.RLock()
+	defer dbMu.RUnlock()
+
+	rows, err := db.Query(`
+		SELECT source, toplist_id, name, keep_top, interval, quality, mirror, enabled, last_sync, last_error
+		FROM toplist_subscriptions ORDER BY rowid
+	`)
+	if err != nil {
+		return []ToplistSubscription{}
+	}
+	defer rows.Close()
+
+	subs := []ToplistSubscription{}
+	for rows.Next() {
+		var s ToplistSubscription
+		if err := rows.Scan(&s.Source, &s.ToplistID, &s.Name, &s.KeepTop, &s.Interval, &s.Quality,
+			&s.Mirror, &s.Enabled, &s.LastSync, &s.LastError); err != nil {
+			continue
+		}
+		subs = append(subs, s)
+	}
+	return subs
+}
+
+// GetToplistSubscription 获取单个排行榜的订阅
+func GetToplistSubscription(source, id string) (ToplistSubscription, bool) {
+	for _, s := range GetToplistSubscriptions() {
+		if s.Source == source && s.ToplistID == id {
+			return s, true
+		}
+	}
+	return ToplistSubscription{}, false
+}
+
+// SetToplistSubscription 新建或修改排行榜订阅，保留上次同步状态
+func SetToplistSubscription(s ToplistSubscription) error {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+
+	_, err := db.Exec(`
+		INSERT INTO toplist_subscriptions (source, toplist_id, name, keep_top, interval, quality, mirror, enabled)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (source, toplist_id) DO UPDATE SET
+			name = excluded.name,
+			keep_top = excluded.keep_top,
+			interval = excluded.interval,
+			quality = excluded.quality,
+			mirror = excluded.mirror,
+			enabled = excluded.enabled
+	`, s.Source, s.ToplistID, s.Name, s.KeepTop, s.Interval, s.Quality, s.Mirror, s.Enabled)
+	return err
+}
+
+// DeleteToplistSubscription 取消排行榜订阅
+func DeleteToplistSubscription(source, id string) error {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+
+	_, err := db.Exec("DELETE FROM toplist_subscriptions WHERE source = ? AND toplist_id = ?", source, id)
+	return err
+}
+
+// SetToplistSubscriptionSynced 记录排行榜订阅的同步时间和错误信息
+func SetToplistSubscriptionSynced(source, id, syncTime, syncErr string) error {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+
+	_, err := db.Exec(`
+		UPDATE toplist_subscriptions SET last_sync = ?, last_error = ?
+		WHERE source = ? AND toplist_id = ?
+	`, syncTime, syncErr, source, id)
+	return err
+}
+
+// RankPoint 歌曲在某次快照中的排名，未上榜时 Rank 为 0
+type RankPoint struct {
+	SnapshotID int64  `json:"snapshotId"`
+	Time       string `json:"time"`
+	Rank       int    `json:"rank"`
+}
+
+// ToplistSnapshotInfo 快照概要（不含歌曲）
+type ToplistSnapshotInfo struct {
+	ID    int64  `json:"id"`
+	Time  string `json:"time"`
+	Count int    `json:"count"`
+}
+
+// GetToplistSnapshots 获取排行榜的快照列表，最新的在前
+func GetToplistSnapshots(source, id string, limit int) []ToplistSnapshotInfo {
+	dbMu.RLock()
+	defer dbMu.RUnlock()
+
+	rows, err := db.Query(`
+		SELECT t.id, t.time, COUNT(s.rank)
+		FROM toplist_snapshots AS t
+		LEFT JOIN toplist_snapshot_songs AS s ON s.snapshot_id = t.id
+		WHERE t.source = ? AND t.toplist_id = ?
+		GROUP BY t.id ORDER BY t.id DESC LIMIT ?
+	`, source, id, limit)
+	if err != nil {
+		return []ToplistSnapshotInfo{}
+	}
+	defer rows.Close()
+
+	snapshots := []ToplistSnapshotInfo{}
+	for rows.Next() {
+		var s ToplistSnapshotInfo
+		if err := rows.Scan(&s.ID, &s.Time, &s.Count); err != nil {
+			continue
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots
+}
+
+// GetRecentToplistSnapshots 获取排行榜最近的 n 个快照（含歌曲），最新的在前
+func GetRecentToplistSnapshots(source, id string, n int) []ToplistSnapshot {
+	dbMu.RLock()
+	defer dbMu.RUnlock()
+
+	rows, err := db.Query(`
+		SELECT id, time FROM toplist_snapshots
+		WHERE source = ? AND toplist_id = ?
+		ORDER BY id DESC LIMIT ?
+	`, source, id, n)
+	if err != nil {
+		return nil
+	}
+
+	var snapshots []ToplistSnapshot
+	for rows.Next() {
+		snap := ToplistSnapshot{Source: source, ToplistID: id}
+		if err := rows.Scan(&snap.ID, &snap.Time); err != nil {
+			continue
+		}
+		snapshots = append(snapshots, snap)
+	}
+	rows.Close()
+
+	for i := range snapshots {
+		snapshots[i].Songs = getSnapshotSongs(snapshots[i].ID)
+	}
+	return snapshots
+}
+
+// GetLatestToplistSnapshot 获取排行榜最近一次快照
+func GetLatestToplistSnapshot(source, id string) (ToplistSnapshot, bool) {
+	snapshots := GetRecentToplistSnapshots(source, id, 1)
+	if len(snapshots) == 0 {
+		return ToplistSnapshot{}, false
+	}
+	return snapshots[0], true
+}
+
+// getSnapshotSongs 获取快照中的歌曲（调用前需持有锁）
+func getSnapshotSongs(snapshotID int64) []ToplistSong {
+	rows, err := db.Query(`
+		SELECT rank, song_id, song_source, name, artist, album, duration
+		FROM toplist_snapshot_songs WHERE snapshot_id = ? ORDER BY rank
+	`, snapshotID)
+	if err != nil {
+		return []ToplistSong{}
+	}
+	defer rows.Close()
+
+	songs := []ToplistSong{}
+	for rows.Next() {
+		var s ToplistSong
+		if err := rows.Scan(&s.Rank, &s.ID, &s.Source, &s.Name, &s.Artist, &s.Album, &s.Duration); err != nil {
+			continue
+		}
+		songs = append(songs, s)
+	}
+	return songs
+}
+
+// GetSongRankHistory 获取歌曲在排行榜各次快照中的排名，按时间先后排列
+func GetSongRankHistory(source, id, songSource, songID string, limit int) []RankPoint {
+	dbMu.RLock()
+	defer dbMu.RUnlock()
+
+	rows, err := db.Query(`
+		SELECT id, time, rank FROM (
+			SELECT t.id, t.time, COALESCE(MIN(s.rank), 0) AS rank
+			FROM toplist_snapshots AS t
+			LEFT JOIN toplist_snapshot_songs AS s
+				ON s.snapshot_id = t.id AND s.song_source = ? AND s.song_id = ?
+			WHERE t.source = ? AND t.toplist_id = ?
+			GROUP BY t.id ORDER BY t.id DESC LIMIT ?
+		) ORDER BY id
+	`, songSource, songID, source, id, limit)
+	if err != nil {
+		return []RankPoint{}
+	}
+	defer rows.Close()
+
+	points := []RankPoint{}
+	for rows.Next() {
+		var p RankPoint
+		if err := rows.Scan(&p.SnapshotID, &p.Time, &p.Rank); err != nil {
+			continue
+		}
+		points = append(points, p)
+	}
+	return points
+}